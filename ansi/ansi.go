@@ -0,0 +1,191 @@
+// Package ansi renders the Gemtext node tree for a terminal,
+// the output suits a pager such as less -R.
+package ansi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/shrmpy/gmi"
+)
+
+// Renderer holds the options to format a tree for the terminal
+type Renderer struct {
+	// Width in columns to wrap text lines (default 80)
+	Width int
+	// Color enables the ANSI escape sequences
+	Color bool
+}
+
+// SGR escape sequences
+const (
+	reset     = "\x1b[0m"
+	bold      = "\x1b[1m"
+	faint     = "\x1b[2m"
+	italic    = "\x1b[3m"
+	underline = "\x1b[4m"
+	magenta   = "\x1b[35m"
+	cyan      = "\x1b[36m"
+	blue      = "\x1b[34m"
+	green     = "\x1b[32m"
+)
+
+const defaultWidth = 80
+
+// Render writes the tree with default options (80 columns, no color)
+func Render(w io.Writer, t *gmi.Tree) error {
+	var r Renderer
+	return r.Render(w, t)
+}
+
+// Render writes the tree wrapped at Width; links are numbered
+// in the same order as t.Links() so a pager can follow them.
+func (r *Renderer) Render(w io.Writer, t *gmi.Tree) error {
+	var (
+		bw    = bufio.NewWriter(w)
+		width = r.Width
+		seq   int
+	)
+	if width <= 0 {
+		width = defaultWidth
+	}
+	if t == nil || t.Root == nil {
+		return nil
+	}
+	for _, n := range t.Root.Nodes {
+		switch no := n.(type) {
+		case *gmi.HeadingNode:
+			var style = bold
+			switch no.Level {
+			case 1:
+				style += magenta
+			case 2:
+				style += cyan
+			}
+			r.hanging(bw, "", "", no.Heading, width, style)
+		case *gmi.ItemNode:
+			r.hanging(bw, "• ", "  ", no.Item, width, "")
+		case *gmi.QuoteNode:
+			r.hanging(bw, "│ ", "│ ", no.Quote, width, italic)
+		case *gmi.LinkNode:
+			seq++
+			var (
+				name  = no.Friendly
+				label = fmt.Sprintf("[%d] ", seq)
+			)
+			if name == "" && no.URL != nil {
+				name = no.URL.String()
+			}
+			r.hanging(bw, r.paint(label, blue+bold), strings.Repeat(" ", len(label)), name, width, blue+underline)
+		case *gmi.PromptNode:
+			// numbered like links, the marker tells input is asked for
+			seq++
+			var (
+				name  = no.Friendly
+				label = fmt.Sprintf("[%d?] ", seq)
+			)
+			if name == "" && no.URL != nil {
+				name = no.URL.String()
+			}
+			r.hanging(bw, r.paint(label, blue+bold), strings.Repeat(" ", len(label)), name, width, blue+underline)
+		case *gmi.PreformatNode:
+			// preformat is never wrapped
+			for _, row := range strings.SplitAfter(string(no.Body), "\n") {
+				if row == "" {
+					continue
+				}
+				bw.WriteString(r.paint(sanitize(strings.TrimSuffix(row, "\n")), green))
+				bw.WriteString("\n")
+			}
+		case *gmi.TextNode:
+			r.hanging(bw, "", "", string(no.Text), width, "")
+		}
+	}
+	return bw.Flush()
+}
+
+// write the wrapped text, first prefix on the first row and
+// the indent (same display width) on the continuation rows
+func (r *Renderer) hanging(bw *bufio.Writer, first string, indent string, text string, width int, style string) {
+	var room = width - runewidth.StringWidth(indent)
+	if room < 1 {
+		room = 1
+	}
+	for i, row := range Wrap(sanitize(text), room) {
+		if i == 0 {
+			bw.WriteString(first)
+		} else {
+			bw.WriteString(indent)
+		}
+		bw.WriteString(r.paint(row, style))
+		bw.WriteString("\n")
+	}
+}
+
+// the capsule text cannot send escape sequences of its own (clear
+// the screen, set the title, forge links), controls other than the
+// tab are shown as the replacement character
+func sanitize(text string) string {
+	return strings.Map(func(ch rune) rune {
+		if ch == '\t' {
+			return ch
+		}
+		if ch < 0x20 || ch == 0x7f || ch >= 0x80 && ch < 0xa0 {
+			return '\ufffd'
+		}
+		return ch
+	}, text)
+}
+
+func (r *Renderer) paint(text string, style string) string {
+	if !r.Color || style == "" || text == "" {
+		return text
+	}
+	return style + text + reset
+}
+
+// Wrap breaks the text on word boundaries so each row fits the width
+// in display columns (East Asian wide runes count as two), words wider
+// than the row are broken between runes.
+func Wrap(text string, width int) []string {
+	var (
+		rows []string
+		cur  strings.Builder
+		used int
+	)
+	if width < 1 {
+		width = 1
+	}
+	for _, word := range strings.Fields(text) {
+		var ww = runewidth.StringWidth(word)
+		if used > 0 && used+1+ww <= width {
+			cur.WriteString(" ")
+			cur.WriteString(word)
+			used += 1 + ww
+			continue
+		}
+		if used > 0 {
+			rows = append(rows, cur.String())
+			cur.Reset()
+			used = 0
+		}
+		// break the word which is wider than the row
+		for _, ch := range word {
+			cw := runewidth.RuneWidth(ch)
+			if used > 0 && used+cw > width {
+				rows = append(rows, cur.String())
+				cur.Reset()
+				used = 0
+			}
+			cur.WriteRune(ch)
+			used += cw
+		}
+	}
+	if used > 0 || len(rows) == 0 {
+		rows = append(rows, cur.String())
+	}
+	return rows
+}
@@ -0,0 +1,50 @@
+package ansi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shrmpy/gmi"
+)
+
+// escape sequences of the page are not passed to the terminal
+func TestRenderControls(t *testing.T) {
+	var tests = []struct {
+		name string
+		page string
+		want string
+	}{
+		{"clear screen", "before\x1b[2Jafter\n", "before�[2Jafter"},
+		{"window title", "# \x1b]0;owned\x07Title\n", "�]0;owned�Title"},
+		{"hyperlink", "=> /x \x1b]8;;https://evil.example/\x1b\\Home\n", "�]8;;https://evil.example/�\\Home"},
+		{"c1 csi", "* item \u009b31m red\n", "item �31m red"},
+		{"delete", "> quote\x7f\n", "quote�"},
+		{"preformat", "```\ncol1\tcol2\x1b[31m\n```\n", "col1\tcol2�[31m"},
+	}
+	for _, tt := range tests {
+		tree, err := gmi.Parse(tt.page)
+		if err != nil {
+			t.Fatalf("%s: Parse, %v", tt.name, err)
+		}
+		for _, color := range []bool{false, true} {
+			var (
+				sb strings.Builder
+				rd = &Renderer{Color: color}
+			)
+			if err = rd.Render(&sb, tree); err != nil {
+				t.Fatalf("%s: Render, %v", tt.name, err)
+			}
+			var out = sb.String()
+			// only the styles of the renderer remain
+			for _, sgr := range []string{reset, bold, faint, italic, underline, magenta, cyan, blue, green} {
+				out = strings.ReplaceAll(out, sgr, "")
+			}
+			if strings.ContainsAny(out, "\x1b\x07\x7f\u009b") {
+				t.Errorf("%s (color %v): control in %q", tt.name, color, out)
+			}
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("%s (color %v): %q does not contain %q", tt.name, color, out, tt.want)
+			}
+		}
+	}
+}
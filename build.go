@@ -0,0 +1,162 @@
+package gmi
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Document constructs a Tree from code with the same node types which
+// the parser produces, e.g.
+//
+//	doc := gmi.NewDocument()
+//	doc.Heading(1, "Logs").Link("/2022-06-01.gmi", "First post")
+//	doc.WriteTo(os.Stdout)
+type Document struct {
+	tree *Tree
+	pos  Pos // byte position of the next line in the serialized text
+	err  error
+}
+
+func NewDocument() *Document {
+	var t = &Tree{}
+	t.Root = t.newList(0)
+	return &Document{tree: t}
+}
+
+// Text appends plain text, each newline starts another text line
+func (d *Document) Text(text string) *Document {
+	for _, row := range strings.Split(text, "\n") {
+		d.append(d.tree.newText(d.pos, row))
+	}
+	return d
+}
+
+// Blank appends an empty line
+func (d *Document) Blank() *Document {
+	d.append(d.tree.newText(d.pos, ""))
+	return d
+}
+
+// Heading appends the heading, level is limited to 1-3
+func (d *Document) Heading(level int, text string) *Document {
+	if level < 1 {
+		level = 1
+	} else if level > 3 {
+		level = 3
+	}
+	d.append(d.tree.newHeading(d.pos, level, oneLine(text), ""))
+	return d
+}
+
+// Link appends the link line, the name is optional
+func (d *Document) Link(rawurl string, name string) *Document {
+	lu, err := url.Parse(strings.TrimSpace(rawurl))
+	if err != nil {
+		if d.err == nil {
+			d.err = fmt.Errorf("Document link URL %q, %w", rawurl, err)
+		}
+		return d
+	}
+	n := d.tree.newLink(d.pos, "")
+	n.URL = lu
+	n.Friendly = oneLine(name)
+	d.append(n)
+	return d
+}
+
+// Prompt appends the input link line (Spartan), the name is optional
+func (d *Document) Prompt(rawurl string, name string) *Document {
+	lu, err := url.Parse(strings.TrimSpace(rawurl))
+	if err != nil {
+		if d.err == nil {
+			d.err = fmt.Errorf("Document prompt URL %q, %w", rawurl, err)
+		}
+		return d
+	}
+	n := d.tree.newPrompt(d.pos, "")
+	n.URL = lu
+	n.Friendly = oneLine(name)
+	d.append(n)
+	return d
+}
+
+// List appends one list item line per item
+func (d *Document) List(items ...string) *Document {
+	for _, it := range items {
+		d.append(d.tree.newItem(d.pos, oneLine(it), ""))
+	}
+	return d
+}
+
+// Quote appends quote lines, each newline starts another quote line
+func (d *Document) Quote(text string) *Document {
+	for _, row := range strings.Split(text, "\n") {
+		d.append(d.tree.newQuote(d.pos, row, ""))
+	}
+	return d
+}
+
+// Pre appends the preformat block with the alt text
+func (d *Document) Pre(alt string, body string) *Document {
+	n := d.tree.newPreformat(d.pos, oneLine(alt))
+	if body != "" && !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	n.Body = []byte(body)
+	d.append(n)
+	return d
+}
+
+// Tree is the document, the error reports the first bad link URL
+func (d *Document) Tree() (*Tree, error) {
+	return d.tree, d.err
+}
+
+// WriteTo serializes the document as gemtext
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.tree.WriteTo(w)
+}
+
+func (d *Document) String() string {
+	var sb strings.Builder
+	d.tree.WriteTo(&sb)
+	return sb.String()
+}
+
+// the serialized line advances the position
+func (d *Document) append(n Node) {
+	var line = fillText(n)
+	d.pos += Pos(len(line) + 1)
+	d.tree.Root.append(n)
+}
+
+// the serialized line becomes the node text (for nodes made by code)
+func fillText(n Node) string {
+	var sb strings.Builder
+	n.writeTo(&sb)
+	switch no := n.(type) {
+	case *LinkNode:
+		no.Text = []byte(sb.String())
+	case *PromptNode:
+		no.Text = []byte(sb.String())
+	case *HeadingNode:
+		no.Text = []byte(sb.String())
+	case *ItemNode:
+		no.Text = []byte(sb.String())
+	case *QuoteNode:
+		no.Text = []byte(sb.String())
+	case *PreformatNode:
+		no.Text = []byte(sb.String())
+	}
+	return sb.String()
+}
+
+// line types cannot span newlines
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
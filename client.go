@@ -0,0 +1,82 @@
+package gmi
+
+import (
+	"bufio"
+	"context"
+	"net/url"
+	"sync"
+)
+
+// Client keeps the settings, rules and trust store which are shared
+// by many requests; it hands out a control (handle) per request
+// and is safe to use from many goroutines.
+type Client struct {
+	cfg   Params
+	rules safemap
+	trust *trustStore
+}
+
+// serialize access to the known capsules file
+type trustStore struct {
+	sync.Mutex
+}
+
+func NewClient(cfg Params) *Client {
+	cl := &Client{
+		cfg:   cfg,
+		rules: safemap{m: make(map[LineType]*rewriter)},
+		trust: &trustStore{},
+	}
+
+	cl.Attach(PlainLine, vanilla)
+	cl.AttachContext(LinkLine, rewriteLink)
+	cl.AttachContext(PromptLine, rewritePrompt)
+	return cl
+}
+
+// Attach registers the rule which every future control inherits
+func (c *Client) Attach(lt LineType, f func(Node) (string, error)) error {
+	return c.AttachContext(lt, adapt(f))
+}
+
+// AttachContext registers the rule which receives the page scope
+func (c *Client) AttachContext(lt LineType, f func(context.Context, Node) (string, error)) error {
+	c.rules.Lock()
+	defer c.rules.Unlock()
+
+	c.rules.m[lt] = &rewriter{fn: f}
+	return nil
+}
+
+// Control makes a per-request handle with its own copy of the rules
+func (c *Client) Control(ctx context.Context) *control {
+	// carry the shared trust store to the TLS verify step
+	ctrl := NewControl(context.WithValue(ctx, trustStoreKey, c.trust))
+
+	c.rules.RLock()
+	defer c.rules.RUnlock()
+	for lt, run := range c.rules.m {
+		ctrl.AttachContext(lt, run.fn)
+	}
+	return ctrl
+}
+
+// Dial is the convenience to make a control and send the request,
+// the caller is responsible to Close the control when done reading.
+func (c *Client) Dial(ctx context.Context, u *url.URL) (*control, *bufio.Reader, error) {
+	ctrl := c.Control(ctx)
+	rdr, err := ctrl.Dial(u, c.cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ctrl, rdr, nil
+}
+
+const trustStoreKey = "KnownCapsulesStore"
+
+func paramTrust(ctx context.Context) *trustStore {
+	if ts, ok := ctx.Value(trustStoreKey).(*trustStore); ok {
+		return ts
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+import "github.com/shrmpy/gmi/feed"
+
+// post is an entry which was seen before
+type post struct {
+	URL     string
+	Title   string
+	Feed    string
+	Updated time.Time
+	Seen    time.Time
+}
+
+// gemlog name, date and title as the link name
+func (p post) line() string {
+	return fmt.Sprintf("%s - %s: %s", p.Updated.Format("2006-01-02"), p.Feed, p.Title)
+}
+
+// database is a JSON file keyed by the entry URL
+type database struct {
+	Posts map[string]post
+}
+
+func openDB(path string) (*database, error) {
+	var db = &database{Posts: make(map[string]post)}
+	buf, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(buf, db); err != nil {
+		return nil, fmt.Errorf("Database format, %w", err)
+	}
+	if db.Posts == nil {
+		db.Posts = make(map[string]post)
+	}
+	return db, nil
+}
+
+// record the entries, the result is the ones not seen before
+func (db *database) merge(feeds []*feed.Feed, now time.Time) []post {
+	var fresh []post
+	for _, fd := range feeds {
+		for _, en := range fd.Entries {
+			var key = en.URL.String()
+			if _, ok := db.Posts[key]; ok {
+				continue
+			}
+			p := post{URL: key, Title: en.Title, Feed: fd.Title, Updated: en.Updated, Seen: now}
+			db.Posts[key] = p
+			fresh = append(fresh, p)
+		}
+	}
+	sortPosts(fresh)
+	return fresh
+}
+
+// posts published after the time, which were seen before this run
+func (db *database) since(ts time.Time, now time.Time) []post {
+	var posts []post
+	for _, p := range db.Posts {
+		if p.Updated.After(ts) && p.Seen.Before(now) {
+			posts = append(posts, p)
+		}
+	}
+	sortPosts(posts)
+	return posts
+}
+
+// write to a temporary file first so a failed run keeps the old data
+func (db *database) save(path string) error {
+	buf, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".feeds-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+import "github.com/shrmpy/gmi"
+import "github.com/shrmpy/gmi/feed"
+import "golang.org/x/sync/errgroup"
+
+func main() {
+	var (
+		subs    = flag.String("subs", "subscriptions.txt", "Subscriptions file (one feed URL per line)")
+		dbf     = flag.String("db", "feeds.json", "Database of seen entries")
+		out     = flag.String("out", "feeds.gmi", "Aggregated Gemtext page")
+		days    = flag.Int("days", 30, "Age limit of posts listed as recent")
+		workers = flag.Int("workers", 4, "Concurrent fetches")
+		timeout = flag.Duration("timeout", 30*time.Second, "Time limit of each fetch")
+		known   = flag.String("known", "known_capsules", "Known capsules file (TOFU)")
+	)
+	flag.Parse()
+
+	urls, err := readSubscriptions(*subs)
+	if err != nil {
+		log.Fatalf("DEBUG Subscriptions, %v", err)
+	}
+	cfg, err := gmi.TrustOnFirstUse(*known)
+	if err != nil {
+		log.Fatalf("DEBUG Known capsules, %v", err)
+	}
+	db, err := openDB(*dbf)
+	if err != nil {
+		log.Fatalf("DEBUG Database, %v", err)
+	}
+	var (
+		now    = time.Now()
+		client = gmi.NewClient(cfg)
+		feeds  = fetchAll(client, urls, *workers, *timeout)
+		fresh  = db.merge(feeds, now)
+	)
+	if err = db.save(*dbf); err != nil {
+		log.Fatalf("DEBUG Database save, %v", err)
+	}
+	var recent = db.since(now.AddDate(0, 0, -*days), now)
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("DEBUG Output file, %v", err)
+	}
+	defer f.Close()
+	if err = writePage(f, fresh, recent, now); err != nil {
+		log.Fatalf("DEBUG Write page, %v", err)
+	}
+	log.Printf("INFO %d feeds, %d new posts, %s", len(feeds), len(fresh), *out)
+}
+
+// fetch the subscriptions concurrently (a failed feed is logged)
+func fetchAll(client *gmi.Client, urls []string, workers int, timeout time.Duration) []*feed.Feed {
+	var (
+		mu    sync.Mutex
+		feeds []*feed.Feed
+		grp   errgroup.Group
+	)
+	grp.SetLimit(workers)
+	for _, addr := range urls {
+		addr := addr
+		grp.Go(func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			fd, err := fetch(ctx, client, addr)
+			if err != nil {
+				log.Printf("ERROR feed %s, %v", addr, err)
+				return nil
+			}
+			mu.Lock()
+			feeds = append(feeds, fd)
+			mu.Unlock()
+			return nil
+		})
+	}
+	grp.Wait()
+	return feeds
+}
+
+// the subscription is either a gemfeed page or Atom XML
+func fetch(ctx context.Context, client *gmi.Client, addr string) (*feed.Feed, error) {
+	req, err := gmi.Format(addr, "")
+	if err != nil {
+		return nil, err
+	}
+	ctrl, rdr, err := client.Dial(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer ctrl.Close()
+	var page = ctrl.URL()
+	if feed.IsAtom(ctrl.Meta()) {
+		return feed.ParseAtom(rdr, page)
+	}
+	buf, err := io.ReadAll(rdr)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := gmi.Parse(string(buf))
+	if err != nil {
+		return nil, err
+	}
+	return feed.Parse(tree, page)
+}
+
+func readSubscriptions(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var urls []string
+	var sc = bufio.NewScanner(f)
+	for sc.Scan() {
+		var row = strings.TrimSpace(sc.Text())
+		if row == "" || strings.HasPrefix(row, "#") {
+			continue
+		}
+		// a gemtext link line works too
+		if strings.HasPrefix(row, "=>") {
+			fields := strings.Fields(strings.TrimPrefix(row, "=>"))
+			if len(fields) == 0 {
+				continue
+			}
+			row = fields[0]
+		}
+		urls = append(urls, row)
+	}
+	return urls, sc.Err()
+}
+
+// new posts of this run and recent posts (newest first)
+func writePage(w io.Writer, fresh []post, recent []post, now time.Time) error {
+	var doc = gmi.NewDocument().Heading(1, "Feeds").
+		Text(fmt.Sprintf("Updated %s", now.Format("2006-01-02 15:04"))).Blank()
+
+	doc.Heading(2, "New")
+	if len(fresh) == 0 {
+		doc.Text("No new posts.")
+	}
+	for _, p := range fresh {
+		doc.Link(p.URL, p.line())
+	}
+	doc.Blank().Heading(2, "Recent")
+	for _, p := range recent {
+		doc.Link(p.URL, p.line())
+	}
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+func sortPosts(posts []post) {
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].Updated.After(posts[j].Updated)
+	})
+}
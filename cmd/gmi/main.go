@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+import "github.com/shrmpy/gmi/server"
+
+const usage = `Usage:
+  gmi cert new    --host example.org [--alg ecdsa|ed25519] [--days n] [--cert file] [--key file]
+  gmi cert rotate [--host example.org] [--alg ecdsa|ed25519] [--keep-key] [--days n] [--cert file] [--key file]
+  gmi cert info   [--cert file] [--key file]
+`
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "cert" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var (
+		cmd  = os.Args[2]
+		fset = flag.NewFlagSet("cert "+cmd, flag.ExitOnError)
+		host = fset.String("host", "", "Host names or addresses (comma separated)")
+		alg  = fset.String("alg", server.ECDSA, "Key algorithm, ecdsa or ed25519")
+		days = fset.Int("days", int(server.DefaultValidity/(24*time.Hour)), "Days of validity")
+		cert = fset.String("cert", "cert.pem", "Certificate file")
+		key  = fset.String("key", "key.pem", "Private key file")
+		keep = fset.Bool("keep-key", false, "Rotate signs the old key again (the pins of the clients stay valid)")
+	)
+	fset.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	fset.Parse(os.Args[3:])
+
+	var opts = server.CertOptions{
+		Hosts:     hosts(*host),
+		Algorithm: *alg,
+		Validity:  time.Duration(*days) * 24 * time.Hour,
+		KeepKey:   *keep,
+	}
+	var err error
+	switch cmd {
+	case "new":
+		err = server.WriteCertificate(*cert, *key, opts)
+		if errors.Is(err, server.ErrCertExists) {
+			log.Fatalf("DEBUG %v (use rotate to replace it)", err)
+		}
+	case "rotate":
+		err = server.Rotate(*cert, *key, opts)
+	case "info":
+		err = info(*cert, *key)
+	default:
+		fset.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("DEBUG cert %s, %v", cmd, err)
+	}
+	if cmd != "info" {
+		info(*cert, *key)
+	}
+}
+
+func info(certFile string, keyFile string) error {
+	cert, err := server.LoadCertificate(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	var leaf = cert.Leaf
+	var names = leaf.DNSNames
+	for _, ip := range leaf.IPAddresses {
+		names = append(names, ip.String())
+	}
+	fmt.Printf("Subject:     %s\n", leaf.Subject.CommonName)
+	fmt.Printf("Names:       %s\n", strings.Join(names, ", "))
+	fmt.Printf("Algorithm:   %s\n", leaf.PublicKeyAlgorithm)
+	fmt.Printf("Valid until: %s\n", leaf.NotAfter.Format("2006-01-02"))
+	fmt.Printf("SHA-256:     %s\n", server.Fingerprint(leaf))
+	return nil
+}
+
+func hosts(list string) []string {
+	var names []string
+	for _, h := range strings.Split(list, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			names = append(names, h)
+		}
+	}
+	return names
+}
@@ -5,10 +5,21 @@ import (
 	"context"
 	"log"
 	"net/url"
+	"strings"
 
 	"github.com/shrmpy/gmi"
 )
 
+// make the long-lived client which each capsule request shares
+func (g *Game) newClient() {
+	// avoid coupling gmi pkg to cfg struct
+	var params = &geminiParams{args: g.cfg}
+	g.client = gmi.NewClient(params)
+	// substitute our customized rules
+	g.client.Attach(gmi.LinkLine, g.rewriteLink)
+	g.client.Attach(gmi.PromptLine, g.rewritePrompt)
+	g.client.Attach(gmi.PlainLine, g.rewritePlain)
+}
 func (g *Game) capsule(addr string) {
 	var (
 		req *url.URL
@@ -16,19 +27,14 @@ func (g *Game) capsule(addr string) {
 		err error
 		ctx = context.Background()
 	)
-	// avoid coupling gmi pkg to cfg struct
-	var ctrl = gmi.NewControl(ctx)
-	// substitute our customized rules
-	ctrl.Attach(gmi.LinkLine, g.rewriteLink)
-	ctrl.Attach(gmi.PlainLine, g.rewritePlain)
 	log.Printf("INFO Format URL, %s", addr)
 	if req, err = gmi.Format(addr, string(g.panel.bar.text)); err != nil {
 		log.Printf("INFO URL format error, %v", err.Error())
 		return
 	}
-	var params = &geminiParams{args: g.cfg}
 	log.Printf("INFO Dial Gemini pod, %s", req.String())
-	if rdr, err = ctrl.Dial(req, params); err != nil {
+	ctrl, rdr, err := g.client.Dial(ctx, req)
+	if err != nil {
 		log.Printf("INFO Dial error, %v", err.Error())
 		return
 	}
@@ -47,7 +53,7 @@ func (g *Game) capsule(addr string) {
 }
 
 // define how to treat Gem links
-func (g *Game) rewriteLink(no gmi.Node) string {
+func (g *Game) rewriteLink(no gmi.Node) (string, error) {
 	var (
 		lnk  = no.(*gmi.LinkNode)
 		seq  = lnk.Position()
@@ -63,16 +69,43 @@ func (g *Game) rewriteLink(no gmi.Node) string {
 		// it contains the link URL as the data field
 		g.bus <- signal{op: 1965, data: addr}
 	})
-	return ""
+	return "", nil
 }
 
-// define how to treat Gem plain text
-func (g *Game) rewritePlain(no gmi.Node) string {
+// define how to treat input lines (Spartan)
+func (g *Game) rewritePrompt(no gmi.Node) (string, error) {
 	var (
-		tn  = no.(*gmi.TextNode)
-		seq = tn.Position()
+		pr   = no.(*gmi.PromptNode)
+		seq  = pr.Position()
+		lu   = pr.URL.String()
+		name = pr.Friendly
 	)
+	if pr.Friendly == "" {
+		name = lu
+	}
+	log.Printf("INFO Gem prompt pos %d, %s", seq, lu)
+	g.panel.AppendLink(int(seq), "[?] "+name, lu, func(addr string) {
+		req, err := gmi.Format(addr, string(g.panel.bar.text))
+		if err != nil {
+			log.Printf("INFO URL format error, %v", err.Error())
+			return
+		}
+		// the text is typed after the query mark, Enter sends it
+		req.RawQuery, req.Fragment = "", ""
+		g.panel.bar.text = []rune(req.String() + "?")
+	})
+	return "", nil
+}
+
+// define how to treat Gem plain text
+// (catchall which also receives headings, lists, quotes and preformat)
+func (g *Game) rewritePlain(no gmi.Node) (string, error) {
+	var seq = no.Position()
 	log.Printf("INFO Gem plain pos %d", seq)
-	g.panel.AppendParagraph(int(seq), no.String())
-	return ""
+	// preformat blocks span many rows, keep byte offsets as the sequence
+	for _, row := range strings.SplitAfter(no.String(), "\n") {
+		g.panel.AppendParagraph(int(seq), strings.TrimSuffix(row, "\n"))
+		seq += gmi.Pos(len(row))
+	}
+	return "", nil
 }
@@ -7,11 +7,13 @@ import (
 )
 
 import "github.com/hajimehoshi/ebiten/v2"
+import "github.com/shrmpy/gmi"
 
 type Game struct {
-	panel *Panel
-	bus   chan signal
-	cfg   *argsCfg
+	panel  *Panel
+	bus    chan signal
+	cfg    *argsCfg
+	client *gmi.Client
 }
 
 func (g *Game) Layout(w int, h int) (int, int) { return w, h }
@@ -55,6 +57,7 @@ func main() {
 		ch <- signal{op: 8888}
 	})
 	var gm = &Game{panel: pn, bus: ch, cfg: cfg}
+	gm.newClient()
 	pn.GeminiFunc(gm.capsule)
 
 	ebiten.SetWindowTitle("gmimo")
@@ -8,6 +8,7 @@ import (
 	"log"
 	"sort"
 	"strings"
+	"sync"
 )
 
 import "github.com/hajimehoshi/ebiten/v2"
@@ -33,6 +34,7 @@ type Panel struct {
 	burger              *Icon
 	fg                  color.RGBA
 	lines               []*GemLine
+	linesMu             sync.Mutex
 	gemini              func(string)
 	sorted              bool
 	offsetY             int
@@ -133,13 +135,18 @@ func (p *Panel) AppendLink(sequence int, name string, lu string, f func(addr str
 	r.Icon.HandleFunc(func(el Element) {
 		f(r.LinkURL)
 	})
+	// rewriter workers append concurrently
+	p.linesMu.Lock()
 	p.lines = append(p.lines, r)
+	p.linesMu.Unlock()
 }
 func (p *Panel) AppendParagraph(sequence int, text string) {
 	var r = &GemLine{Sequence: sequence}
 	r.Icon.fg = color.RGBA{0xff, 0xff, 0xff, 0xff}
 	r.Icon.Text = p.tofu(text)
+	p.linesMu.Lock()
 	p.lines = append(p.lines, r)
+	p.linesMu.Unlock()
 }
 func (p *Panel) QuitFunc(f func(el Element)) {
 	// accept callback function to attach to burger icon
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+import "github.com/shrmpy/gmi"
+
+func main() {
+	var (
+		addr    = flag.String("addr", ":8080", "HTTP listen address")
+		allow   = flag.String("allow", "", "Capsule hosts which may be proxied (comma separated, empty allows all)")
+		deny    = flag.String("deny", "", "Capsule hosts which are refused (comma separated)")
+		known   = flag.String("known", "known_capsules", "Known capsules file (TOFU)")
+		timeout = flag.Duration("timeout", 30*time.Second, "Time limit of each capsule request")
+	)
+	flag.Parse()
+	cfg, err := gmi.TrustOnFirstUse(*known)
+	if err != nil {
+		log.Fatalf("DEBUG Known capsules, %v", err)
+	}
+	var pt = &portal{
+		client:  gmi.NewClient(cfg),
+		cfg:     cfg,
+		allow:   hostSet(*allow),
+		deny:    hostSet(*deny),
+		timeout: *timeout,
+	}
+	var srv = &http.Server{
+		Addr:              *addr,
+		Handler:           pt,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		var sig = make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		log.Printf("INFO shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+	log.Printf("INFO portal on %s", *addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("DEBUG Serve, %v", err)
+	}
+}
+
+// lowercase host names of the comma separated list
+func hostSet(list string) map[string]bool {
+	var set = make(map[string]bool)
+	for _, h := range strings.Split(list, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			set[h] = true
+		}
+	}
+	return set
+}
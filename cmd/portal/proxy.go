@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+import "github.com/shrmpy/gmi"
+import "github.com/shrmpy/gmi/html"
+
+// portal proxies /gemini/<host>/<path> to the capsule, gemtext is
+// rendered as HTML with the links pointing back through the portal
+type portal struct {
+	client  *gmi.Client
+	cfg     gmi.Params
+	allow   map[string]bool // empty allows every host
+	deny    map[string]bool
+	timeout time.Duration
+}
+
+const prefix = "/gemini/"
+
+func (p *portal) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" {
+		p.home(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.EscapedPath(), prefix) {
+		p.fail(w, http.StatusNotFound, "Not found")
+		return
+	}
+	target, err := capsuleURL(r.URL)
+	if err != nil {
+		p.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !p.allowed(target.Hostname()) {
+		p.fail(w, http.StatusForbidden, "Capsule host is not allowed")
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		// answer of the input form becomes the query
+		http.Redirect(w, r, local(gmi.InputURL(target, r.FormValue("input"))), http.StatusSeeOther)
+	case http.MethodGet, http.MethodHead:
+		p.proxy(w, r, target)
+	default:
+		p.fail(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// start page with the address form
+func (p *portal) home(w http.ResponseWriter, r *http.Request) {
+	if addr := strings.TrimSpace(r.FormValue("url")); addr != "" {
+		if !strings.Contains(addr, "://") {
+			addr = "gemini://" + addr
+		}
+		lu, err := gmi.Format(addr, "")
+		if err != nil || lu.Scheme != "gemini" || lu.Hostname() == "" {
+			p.fail(w, http.StatusBadRequest, "Gemini address required")
+			return
+		}
+		http.Redirect(w, r, local(lu), http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	pages.ExecuteTemplate(w, "home", pageData{CSS: template.CSS(html.DefaultCSS)})
+}
+
+func (p *portal) proxy(w http.ResponseWriter, r *http.Request, target *url.URL) {
+	ctx, cancel := context.WithTimeout(r.Context(), p.timeout)
+	defer cancel()
+	var ctrl = p.client.Control(ctx)
+	// bodies of any MIME type are read, redirects are checked here
+	ctrl.Accept(func(string) bool { return true })
+	ctrl.StopRedirect()
+	rdr, err := ctrl.Dial(target, p.cfg)
+	var (
+		se *gmi.StatusError
+		re *gmi.RedirectError
+	)
+	if errors.As(err, &se) {
+		p.status(w, target, se)
+		return
+	}
+	if errors.As(err, &re) {
+		p.redirect(w, r, re.URL)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR portal %s, %v", target, err)
+		p.fail(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	defer ctrl.Close()
+	var meta = ctrl.Meta()
+	if !strings.HasPrefix(meta, "text/gemini") {
+		// the capsule body must not run script on the portal origin
+		w.Header().Set("Content-Type", passType(meta))
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if _, err = io.Copy(w, rdr); err != nil {
+			log.Printf("INFO portal body %s, %v", target, err)
+		}
+		return
+	}
+	buf, err := io.ReadAll(rdr)
+	if err != nil {
+		p.fail(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	tree, err := gmi.Parse(string(buf))
+	if err != nil {
+		p.fail(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	var rd = &html.Renderer{Page: true, Rewrite: rewrite(target)}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err = rd.Render(w, tree); err != nil {
+		log.Printf("INFO portal render %s, %v", target, err)
+	}
+}
+
+// the browser follows the redirect (3x) through the portal, only to
+// the capsules which may be proxied
+func (p *portal) redirect(w http.ResponseWriter, r *http.Request, lu *url.URL) {
+	if lu.Scheme != "gemini" {
+		p.fail(w, http.StatusBadGateway, "Capsule redirects outside of Gemini")
+		return
+	}
+	if !p.allowed(lu.Hostname()) {
+		p.fail(w, http.StatusForbidden, "Capsule host is not allowed")
+		return
+	}
+	http.Redirect(w, r, local(lu), http.StatusFound)
+}
+
+// text (html too) and markup are shown as plain text, the other
+// bodies keep the MIME type of the capsule
+func passType(meta string) string {
+	var mt, params, _ = strings.Cut(meta, ";")
+	mt = strings.ToLower(strings.TrimSpace(mt))
+	if strings.HasPrefix(mt, "text/") || strings.HasSuffix(mt, "+xml") || strings.HasSuffix(mt, "/xml") {
+		if params = strings.TrimSpace(params); strings.HasPrefix(strings.ToLower(params), "charset=") {
+			return "text/plain; " + params
+		}
+		return "text/plain; charset=utf-8"
+	}
+	if mt == "" {
+		return "application/octet-stream"
+	}
+	return meta
+}
+
+// input (1x) is asked with the form, the others map to HTTP errors
+func (p *portal) status(w http.ResponseWriter, target *url.URL, se *gmi.StatusError) {
+	if se.Status/10 == 1 {
+		var action = *target
+		action.RawQuery = ""
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		pages.ExecuteTemplate(w, "input", pageData{
+			CSS:       template.CSS(html.DefaultCSS),
+			Message:   se.Meta,
+			Action:    local(&action),
+			Sensitive: se.Status == 11,
+		})
+		return
+	}
+	if se.Status == 44 {
+		// slow down, the meta is the seconds to wait
+		w.Header().Set("Retry-After", se.Meta)
+	}
+	p.fail(w, httpStatus(se.Status), fmt.Sprintf("%d %s", se.Status, se.Meta))
+}
+
+func (p *portal) fail(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	pages.ExecuteTemplate(w, "error", pageData{
+		CSS:     template.CSS(html.DefaultCSS),
+		Title:   fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		Message: msg,
+	})
+}
+
+// deny wins over allow, an empty allow list permits the rest
+func (p *portal) allowed(host string) bool {
+	var h = strings.ToLower(host)
+	if p.deny[h] {
+		return false
+	}
+	return len(p.allow) == 0 || p.allow[h]
+}
+
+// HTTP equivalent of the Gemini failure status
+func httpStatus(status int) int {
+	switch status {
+	case 44:
+		return http.StatusTooManyRequests
+	case 51:
+		return http.StatusNotFound
+	case 52:
+		return http.StatusGone
+	case 53:
+		return http.StatusForbidden
+	case 59:
+		return http.StatusBadRequest
+	}
+	switch status / 10 {
+	case 4:
+		return http.StatusServiceUnavailable
+	case 6:
+		// the portal has no client certificates
+		return http.StatusForbidden
+	}
+	return http.StatusBadGateway
+}
+
+// capsule address of the portal path, /gemini/host/path?query
+func capsuleURL(u *url.URL) (*url.URL, error) {
+	var rest = strings.TrimPrefix(u.EscapedPath(), prefix)
+	host, path, _ := strings.Cut(rest, "/")
+	if host == "" {
+		return nil, fmt.Errorf("Capsule host is missing")
+	}
+	lu, err := url.Parse("gemini://" + host + "/" + path)
+	if err != nil {
+		return nil, fmt.Errorf("Capsule address malformed, %w", err)
+	}
+	lu.RawQuery = u.RawQuery
+	return gmi.Format(lu.String(), "")
+}
+
+// portal address of the capsule URL (the default port is left out)
+func local(u *url.URL) string {
+	var (
+		host = strings.TrimSuffix(u.Host, ":1965")
+		path = u.EscapedPath()
+	)
+	if path == "" {
+		path = "/"
+	}
+	var addr = prefix + host + path
+	if u.RawQuery != "" {
+		addr += "?" + u.RawQuery
+	}
+	return addr
+}
+
+// gemini links go through the portal, other schemes are kept
+func rewrite(base *url.URL) func(*url.URL) string {
+	return func(lu *url.URL) string {
+		var abs = base.ResolveReference(lu)
+		if abs.Scheme != "gemini" {
+			return abs.String()
+		}
+		return local(abs)
+	}
+}
+
+type pageData struct {
+	CSS       template.CSS
+	Title     string
+	Message   string
+	Action    string
+	Sensitive bool
+}
+
+var pages = template.Must(template.New("").Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+{{.CSS}}</style>
+</head>
+<body>
+{{end}}
+{{define "home"}}{{template "head" .}}<h1>Gemini portal</h1>
+<form action="/" method="get">
+<input name="url" size="40" placeholder="gemini://example.org/" autofocus>
+<button>Go</button>
+</form>
+</body>
+</html>
+{{end}}
+{{define "input"}}{{template "head" .}}<form action="{{.Action}}" method="post">
+<p><label for="input">{{.Message}}</label></p>
+<input id="input" name="input" size="40" {{if .Sensitive}}type="password"{{end}} autofocus>
+<button>Send</button>
+</form>
+</body>
+</html>
+{{end}}
+{{define "error"}}{{template "head" .}}<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+</body>
+</html>
+{{end}}
+`))
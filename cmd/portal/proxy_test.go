@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+import "github.com/shrmpy/gmi"
+import "github.com/shrmpy/gmi/server"
+
+const home = `# Capsule
+=> /about.gmi About
+=> sub/page.gmi?q=1 Relative
+=> gemini://other.example/x Other capsule
+=> gemini://localhost:1965/d Default port
+=> https://web.example/ Web
+`
+
+// capsule on a local port which answers with the response of the path
+func serveCapsule(t *testing.T, responses map[string]string) string {
+	t.Helper()
+	certPEM, keyPEM, err := server.NewCertificate(server.CertOptions{Hosts: []string{"localhost"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil {
+					return
+				}
+				req, err := url.Parse(strings.TrimRight(line, "\r\n"))
+				if err != nil {
+					return
+				}
+				resp, ok := responses[req.Path]
+				if !ok {
+					resp = "51 Not found\r\n"
+				}
+				io.WriteString(conn, resp)
+			}(conn)
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return "localhost:" + port
+}
+
+func TestPortal(t *testing.T) {
+	var capsule = serveCapsule(t, map[string]string{
+		"/":      "20 text/gemini\r\n" + home,
+		"/moved": "31 /\r\n",
+		"/away":  "30 gemini://denied.example/\r\n",
+		"/web":   "30 https://web.example/\r\n",
+		"/ask":   "11 Pass phrase?\r\n",
+		"/slow":  "44 30\r\n",
+		"/gone":  "52 Gone\r\n",
+		"/img":   "20 image/png\r\n\x89PNG",
+		"/html":  "20 text/html; charset=latin1\r\n<script>alert(1)</script>",
+	})
+	cfg, err := gmi.TrustOnFirstUse(filepath.Join(t.TempDir(), "known_capsules"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p = &portal{
+		client:  gmi.NewClient(cfg),
+		cfg:     cfg,
+		deny:    hostSet("denied.example"),
+		timeout: 5 * time.Second,
+	}
+	var local = "/gemini/" + capsule
+	var tests = []struct {
+		name     string
+		method   string
+		path     string
+		form     string
+		code     int
+		header   string // name: value
+		contains []string
+	}{
+		{"page", "GET", local + "/", "", http.StatusOK, "Content-Type: text/html; charset=utf-8", []string{
+			`<h1>Capsule</h1>`,
+			`href="` + local + `/about.gmi"`,
+			`href="` + local + `/sub/page.gmi?q=1"`,
+			`href="/gemini/other.example/x"`,
+			`href="/gemini/localhost/d"`,
+			`href="https://web.example/"`,
+		}},
+		{"redirect", "GET", local + "/moved", "", http.StatusFound, "Location: " + local + "/", nil},
+		{"redirect to a denied host", "GET", local + "/away", "", http.StatusForbidden, "", []string{"Capsule host is not allowed"}},
+		{"redirect out of gemini", "GET", local + "/web", "", http.StatusBadGateway, "", []string{"Capsule redirects outside of Gemini"}},
+		{"input", "GET", local + "/ask", "", http.StatusOK, "", []string{`action="` + local + `/ask"`, "Pass phrase?", `type="password"`}},
+		{"input answer", "POST", local + "/ask", "input=a b", http.StatusSeeOther, "Location: " + local + "/ask?a%20b", nil},
+		{"not found", "GET", local + "/missing", "", http.StatusNotFound, "", []string{"51 Not found"}},
+		{"gone", "GET", local + "/gone", "", http.StatusGone, "", nil},
+		{"slow down", "GET", local + "/slow", "", http.StatusTooManyRequests, "Retry-After: 30", nil},
+		{"binary", "GET", local + "/img", "", http.StatusOK, "Content-Security-Policy: sandbox", []string{"\x89PNG"}},
+		{"html as text", "GET", local + "/html", "", http.StatusOK, "Content-Type: text/plain; charset=latin1", []string{"<script>"}},
+		{"denied host", "GET", "/gemini/denied.example/", "", http.StatusForbidden, "", nil},
+		{"no host", "GET", "/gemini/", "", http.StatusBadRequest, "", []string{"Capsule host is missing"}},
+		{"outside the prefix", "GET", "/other", "", http.StatusNotFound, "", nil},
+		{"method", "PUT", local + "/", "", http.StatusMethodNotAllowed, "", nil},
+		{"home", "GET", "/", "", http.StatusOK, "", []string{`<input name="url"`}},
+		{"home address", "GET", "/?url=example.org/a", "", http.StatusFound, "Location: /gemini/example.org/a", nil},
+		{"home other scheme", "GET", "/?url=https://example.org/", "", http.StatusBadRequest, "", nil},
+	}
+	for _, tt := range tests {
+		var req = httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.form))
+		if tt.form != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		var rec = httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("%s: status %d, want %d (%s)", tt.name, rec.Code, tt.code, rec.Body.String())
+			continue
+		}
+		if tt.header != "" {
+			name, value, _ := strings.Cut(tt.header, ": ")
+			if got := rec.Header().Get(name); got != value {
+				t.Errorf("%s: %s %q, want %q", tt.name, name, got, value)
+			}
+		}
+		for _, want := range tt.contains {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("%s: body %q does not contain %q", tt.name, rec.Body.String(), want)
+			}
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	var base, _ = url.Parse("gemini://capsule.example/dir/page.gmi?x=1")
+	var tests = []struct {
+		link string
+		want string
+	}{
+		{"other.gmi", "/gemini/capsule.example/dir/other.gmi"},
+		{"/top.gmi", "/gemini/capsule.example/top.gmi"},
+		{"../up.gmi?q=a%20b", "/gemini/capsule.example/up.gmi?q=a%20b"},
+		{"?search", "/gemini/capsule.example/dir/page.gmi?search"},
+		{"//other.example", "/gemini/other.example/"},
+		{"gemini://other.example:1965/a%20b", "/gemini/other.example/a%20b"},
+		{"gemini://other.example:1966/", "/gemini/other.example:1966/"},
+		{"https://web.example/x", "https://web.example/x"},
+		{"mailto:ann@example.org", "mailto:ann@example.org"},
+		{"gopher://hole.example/1/", "gopher://hole.example/1/"},
+	}
+	var fn = rewrite(base)
+	for _, tt := range tests {
+		lu, err := url.Parse(tt.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fn(lu); got != tt.want {
+			t.Errorf("%s: link %s, want %s", tt.link, got, tt.want)
+		}
+	}
+}
+
+// the portal path maps to the capsule address and back
+func TestCapsuleURL(t *testing.T) {
+	var tests = []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		// the default port is added for the dial, the portal path leaves it out
+		{"/gemini/capsule.example", "gemini://capsule.example:1965/", true},
+		{"/gemini/capsule.example/", "gemini://capsule.example:1965/", true},
+		{"/gemini/capsule.example/a%20b/c.gmi?q=1", "gemini://capsule.example:1965/a%20b/c.gmi?q=1", true},
+		{"/gemini/capsule.example:1966/x", "gemini://capsule.example:1966/x", true},
+		{"/gemini/", "", false},
+		{"/gemini//path", "", false},
+	}
+	for _, tt := range tests {
+		lu, err := capsuleURL(mustURL(t, tt.path))
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("%s: capsuleURL error %v, want ok %v", tt.path, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if lu.String() != tt.want {
+			t.Errorf("%s: capsule %s, want %s", tt.path, lu, tt.want)
+		}
+		if back := local(lu); strings.TrimSuffix(back, "/") != strings.TrimSuffix(tt.path, "/") {
+			t.Errorf("%s: portal path %s", tt.path, back)
+		}
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	var tests = []struct {
+		status int
+		want   int
+	}{
+		{40, http.StatusServiceUnavailable},
+		{41, http.StatusServiceUnavailable},
+		{44, http.StatusTooManyRequests},
+		{50, http.StatusBadGateway},
+		{51, http.StatusNotFound},
+		{52, http.StatusGone},
+		{53, http.StatusForbidden},
+		{59, http.StatusBadRequest},
+		{60, http.StatusForbidden},
+		{62, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := httpStatus(tt.status); got != tt.want {
+			t.Errorf("%d: HTTP status %d, want %d", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestPassType(t *testing.T) {
+	var tests = []struct {
+		meta string
+		want string
+	}{
+		{"image/png", "image/png"},
+		{"text/html", "text/plain; charset=utf-8"},
+		{"TEXT/HTML; Charset=latin1", "text/plain; Charset=latin1"},
+		{"text/plain; lang=en", "text/plain; charset=utf-8"},
+		{"image/svg+xml", "text/plain; charset=utf-8"},
+		{"application/xml", "text/plain; charset=utf-8"},
+		{"", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		if got := passType(tt.meta); got != tt.want {
+			t.Errorf("%q: type %q, want %q", tt.meta, got, tt.want)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	var tests = []struct {
+		allow string
+		deny  string
+		host  string
+		want  bool
+	}{
+		{"", "", "any.example", true},
+		{"", "Bad.Example", "bad.example", false},
+		{"good.example, other.example", "", "Other.Example", true},
+		{"good.example", "", "any.example", false},
+		{"good.example", "good.example", "good.example", false},
+	}
+	for _, tt := range tests {
+		var p = &portal{allow: hostSet(tt.allow), deny: hostSet(tt.deny)}
+		if got := p.allowed(tt.host); got != tt.want {
+			t.Errorf("allow %q deny %q: %s allowed %v, want %v", tt.allow, tt.deny, tt.host, got, tt.want)
+		}
+	}
+}
+
+func mustURL(t *testing.T, addr string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(addr)
+	if err != nil {
+		t.Fatalf("Parse %s, %v", addr, err)
+	}
+	return u
+}
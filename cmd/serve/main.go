@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+import "github.com/shrmpy/gmi/server"
+
+func main() {
+	var (
+		addr = flag.String("addr", ":1965", "Listen address")
+		root = flag.String("root", ".", "Directory served as the capsule")
+		cert = flag.String("cert", "cert.pem", "TLS certificate file")
+		key  = flag.String("key", "key.pem", "TLS private key file")
+		host = flag.String("host", "", "Generate the certificate for the host when missing")
+		cgi  = flag.String("cgi", "", "Directory of CGI scripts (mounted at /cgi-bin)")
+		tok  = flag.String("titan-token", "", "Accept Titan uploads into the root with the token")
+		max  = flag.Int64("max-upload", 1<<20, "Size limit of Titan uploads")
+	)
+	flag.Parse()
+	if fi, err := os.Stat(*root); err != nil || !fi.IsDir() {
+		log.Fatalf("DEBUG Root directory, %s", *root)
+	}
+	var rt = server.NewRouter()
+	rt.Use(server.Logger)
+	if *cgi != "" {
+		rt.Handle("/cgi-bin/{script...}", &server.CGI{Dir: *cgi, Prefix: "/cgi-bin"})
+	}
+	rt.Handle("/{path...}", server.FileServer(os.DirFS(*root)))
+	var srv = &server.Server{
+		Addr:          *addr,
+		Handler:       rt,
+		ReadTimeout:   10 * time.Second,
+		WriteTimeout:  time.Minute,
+		UploadTimeout: time.Minute,
+	}
+	if *tok != "" {
+		// uploads replace the pages of the capsule
+		var edits = server.Logger(server.UploadFiles(*root, *max, *tok))
+		srv.MaxUploadSize = *max
+		srv.Handler = server.HandlerFunc(func(w server.ResponseWriter, r *server.Request) {
+			if r.Upload != nil {
+				edits.ServeGemini(w, r)
+				return
+			}
+			rt.ServeGemini(w, r)
+		})
+	}
+	if *host != "" {
+		if _, err := server.EnsureCertificate(*cert, *key, *host); err != nil {
+			log.Fatalf("DEBUG Certificate, %v", err)
+		}
+	}
+	go func() {
+		var sig = make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		log.Printf("INFO shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+	log.Printf("INFO serving %s on %s", *root, *addr)
+	if err := srv.ListenAndServeTLS(*cert, *key); err != nil && !errors.Is(err, server.ErrServerClosed) {
+		log.Fatalf("DEBUG Serve, %v", err)
+	}
+}
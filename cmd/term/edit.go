@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+
+	"github.com/shrmpy/gmi"
+)
+
+// open the page source in the editor and upload the changes (Titan)
+func (a *container) edit() {
+	if a.bag.url == "" {
+		a.status.SetRight("No page to edit")
+		return
+	}
+	req, err := gmi.Format(a.bag.url, "")
+	if err != nil {
+		a.status.SetRight(err.Error())
+		return
+	}
+	src, err := a.source(req)
+	if err != nil {
+		a.status.SetRight(err.Error())
+		return
+	}
+	tmp, err := os.CreateTemp("", "page-*.gmi")
+	if err != nil {
+		a.status.SetRight(err.Error())
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(src)
+	tmp.Close()
+	if err != nil {
+		a.status.SetRight(err.Error())
+		return
+	}
+	if err = a.runEditor(tmp.Name()); err != nil {
+		a.status.SetRight(err.Error())
+		return
+	}
+	if buf, err := os.ReadFile(tmp.Name()); err == nil && bytes.Equal(buf, src) {
+		a.status.SetRight("No changes")
+		return
+	}
+	ctrl, _, err := a.client.UploadFile(context.Background(), req, tmp.Name(), a.cfg.Titan.Token)
+	if err != nil {
+		a.status.SetRight(err.Error())
+		return
+	}
+	ctrl.Close()
+	a.status.SetRight("Uploaded")
+	// reload the page
+	a.bus <- signal{op: 1965, data: req.String()}
+}
+
+// raw gemtext of the page (without the rules)
+func (a *container) source(req *url.URL) ([]byte, error) {
+	ctrl, rdr, err := a.client.Dial(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	defer ctrl.Close()
+	return io.ReadAll(rdr)
+}
+
+// the terminal belongs to the editor until it exits
+func (a *container) runEditor(path string) error {
+	var editor = a.cfg.Titan.Editor
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	if err := a.scr.Suspend(); err != nil {
+		return err
+	}
+	defer func() {
+		a.scr.Resume()
+		app.Refresh()
+	}()
+	var cmd = exec.Command(editor, path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
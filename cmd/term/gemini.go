@@ -3,23 +3,27 @@ package main
 import (
 	"context"
 	//"fmt"
+	"strings"
 
 	"github.com/shrmpy/gmi"
 )
 
-func (a *container) capsule(url string, referer string) {
-	var ctrl = gmi.NewControl(context.Background())
+// make the long-lived client which each capsule request shares
+func (a *container) newClient() {
+	var params = &geminiParams{args: a.cfg}
+	a.client = gmi.NewClient(params)
 	// substitute our custom rules
-	ctrl.Attach(gmi.LinkLine, a.rewriteLink)
-	ctrl.Attach(gmi.PlainLine, a.rewritePlain)
-
+	a.client.Attach(gmi.LinkLine, a.rewriteLink)
+	a.client.Attach(gmi.PromptLine, a.rewritePrompt)
+	a.client.Attach(gmi.PlainLine, a.rewritePlain)
+}
+func (a *container) capsule(url string, referer string) {
 	req, err := gmi.Format(url, referer)
 	if err != nil {
 		a.status.SetRight(err.Error())
 		return
 	}
-	var params = &geminiParams{args: a.cfg}
-	rdr, err := ctrl.Dial(req, params)
+	ctrl, rdr, err := a.client.Dial(context.Background(), req)
 	if err != nil {
 		a.status.SetRight(err.Error())
 		return
@@ -37,7 +41,7 @@ func (a *container) capsule(url string, referer string) {
 }
 
 // define how to treat Gem links
-func (a *container) rewriteLink(n gmi.Node) string {
+func (a *container) rewriteLink(n gmi.Node) (string, error) {
 	var (
 		lnk  = n.(*gmi.LinkNode)
 		seq  = lnk.Position()
@@ -56,15 +60,46 @@ func (a *container) rewriteLink(n gmi.Node) string {
 		// it contains the link URL as the data field
 		a.bus <- signal{op: 1965, data: u}
 	})
-	return ""
+	return "", nil
 }
 
-// define how to treat Gem plain text
-func (a *container) rewritePlain(n gmi.Node) string {
+// define how to treat input lines (Spartan)
+func (a *container) rewritePrompt(n gmi.Node) (string, error) {
 	var (
-		tn  = n.(*gmi.TextNode)
-		seq = tn.Position()
+		pr   = n.(*gmi.PromptNode)
+		lu   = pr.URL.String()
+		name = pr.Friendly
 	)
-	a.gvw.AppendParagraph(int(seq), n.String())
-	return ""
+	if name == "" {
+		name = lu
+	}
+	a.gvw.AppendLink(int(pr.Position()), "[?] "+name, lu, func(u string) {
+		// the text is typed into the status bar first
+		a.bag.prompt = u
+		a.bag.input = ""
+	})
+	return "", nil
+}
+
+// send the typed text to the address of the input line
+func (a *container) answer() {
+	req, err := gmi.Format(a.bag.prompt, a.bag.url)
+	a.bag.prompt = ""
+	if err != nil {
+		a.status.SetRight(err.Error())
+		return
+	}
+	a.bus <- signal{op: 1965, data: gmi.InputURL(req, a.bag.input).String()}
+}
+
+// define how to treat Gem plain text
+// (catchall which also receives headings, lists, quotes and preformat)
+func (a *container) rewritePlain(n gmi.Node) (string, error) {
+	var seq = n.Position()
+	// preformat blocks span many rows, keep byte offsets as the sequence
+	for _, row := range strings.SplitAfter(n.String(), "\n") {
+		a.gvw.AppendParagraph(int(seq), strings.TrimSuffix(row, "\n"))
+		seq += gmi.Pos(len(row))
+	}
+	return "", nil
 }
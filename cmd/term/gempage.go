@@ -16,6 +16,7 @@ package main
 
 import (
 	"sort"
+	"sync"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/gdamore/tcell/v2/views"
@@ -25,10 +26,12 @@ import (
 // (encapsulate the cell-model from render concerns)
 // - sorted flag, true indicates page lines finished update
 // - scratch is a throw-away temp space for page lines update
+// - mu guards scratch since rewriter workers append concurrently
 type GemView struct {
 	views.CellView
 	sorted  bool
 	scratch []*GemLine
+	mu      sync.Mutex
 }
 
 func (p *GemView) AppendLink(sequence int, name string, lu string, f func(u string)) {
@@ -49,7 +52,9 @@ func (p *GemView) AppendLink(sequence int, name string, lu string, f func(u stri
 	li.SetOnPressed(func(th *GemLine) {
 		f(th.LinkURL)
 	})
+	p.mu.Lock()
 	p.scratch = append(p.scratch, li)
+	p.mu.Unlock()
 }
 func (p *GemView) AppendParagraph(sequence int, text string) {
 	if p.sorted {
@@ -60,7 +65,9 @@ func (p *GemView) AppendParagraph(sequence int, text string) {
 		Sequence: sequence,
 		Text:     text,
 	}
+	p.mu.Lock()
 	p.scratch = append(p.scratch, li)
+	p.mu.Unlock()
 }
 
 // skip render step for page lines
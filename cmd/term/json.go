@@ -30,6 +30,10 @@ type argsCfg struct {
 		Level string
 		file  *os.File
 	}
+	Titan struct {
+		Token  string
+		Editor string
+	}
 }
 
 //  implements gmi.Params to pass settings to lib calls
@@ -190,6 +194,20 @@ func hydrate(data map[string]interface{}) argsCfg {
 			}
 		}
 	}
+	if dtit, ok := data["titan"]; ok {
+		if mtit, ok := dtit.(map[string]interface{}); ok {
+			if tk, ok := mtit["token"]; ok {
+				if na, ok := tk.(string); ok {
+					tmp.Titan.Token = na
+				}
+			}
+			if ed, ok := mtit["editor"]; ok {
+				if na, ok := ed.(string); ok {
+					tmp.Titan.Editor = na
+				}
+			}
+		}
+	}
 	if dlog, ok := data["log"]; ok {
 		if mlog, ok := dlog.(map[string]interface{}); ok {
 			if lv, ok := mlog["level"]; ok {
@@ -22,6 +22,7 @@ import (
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/gdamore/tcell/v2/views"
+	"github.com/shrmpy/gmi"
 )
 
 var app *views.Application
@@ -33,6 +34,8 @@ type container struct {
 	bag    *gembag
 	bus    chan signal
 	cfg    *argsCfg
+	client *gmi.Client
+	scr    tcell.Screen
 	views.Panel
 }
 
@@ -44,7 +47,9 @@ func (a *container) HandleEvent(ev tcell.Event) bool {
 			app.Refresh()
 			return true
 		case tcell.KeyEnter:
-			if a.bag.gemini {
+			if a.bag.prompt != "" {
+				a.answer()
+			} else if a.bag.gemini {
 				a.bag.gemini = false
 				var lu = a.bag.url
 				if foundAt := strings.Index(lu, ":/"); foundAt == -1 {
@@ -60,6 +65,12 @@ func (a *container) HandleEvent(ev tcell.Event) bool {
 			a.updateKeys()
 			return true
 		case tcell.KeyBackspace, tcell.KeyDelete, tcell.KeyBackspace2:
+			if size := len(a.bag.input); a.bag.prompt != "" {
+				if size > 0 {
+					a.bag.input = a.bag.input[:size-1]
+				}
+				return true
+			}
 			var size = len(a.bag.url)
 			if a.bag.gemini && size > 0 {
 				a.bag.url = a.bag.url[:size-1]
@@ -67,6 +78,10 @@ func (a *container) HandleEvent(ev tcell.Event) bool {
 			}
 
 		case tcell.KeyRune:
+			if a.bag.prompt != "" {
+				a.bag.input += string(ev.Rune())
+				return true
+			}
 			if a.bag.gemini {
 				a.bag.url += string(ev.Rune())
 				return true
@@ -95,6 +110,9 @@ func (a *container) HandleEvent(ev tcell.Event) bool {
 				a.bag.gemini = true
 				a.updateKeys()
 				return true
+			case 'U', 'u':
+				a.edit()
+				return true
 			}
 		}
 	}
@@ -113,7 +131,10 @@ func (a *container) Draw() {
 			app.Quit()
 		}
 	default:
-		if a.bag.gemini {
+		if a.bag.prompt != "" {
+			a.status.SetLeft("input:")
+			a.status.SetCenter(a.bag.input)
+		} else if a.bag.gemini {
 			a.status.SetLeft("gemini://")
 			a.status.SetCenter(a.bag.url)
 		} else {
@@ -127,7 +148,7 @@ func (a *container) Draw() {
 func (a *container) updateKeys() {
 	var (
 		mo = a.gvw.GetModel()
-		mb = "[%AQ%N] Quit"
+		mb = "[%AQ%N] Quit  [%AU%N] Edit"
 	)
 	_, _, enab, shown := mo.GetCursor()
 	if !enab {
@@ -163,6 +184,12 @@ func main() {
 		bag: &gembag{endx: 60, endy: 15},
 		cfg: cfg,
 	}
+	parent.newClient()
+	// keep the screen to suspend it for the editor
+	if parent.scr, err = tcell.NewScreen(); err != nil {
+		log.Fatalf("ERROR Screen, %v", err)
+	}
+	app.SetScreen(parent.scr)
 
 	parent.keybar = views.NewSimpleStyledText()
 	parent.keybar.RegisterStyle('N', tcell.StyleDefault.
@@ -218,6 +245,8 @@ type gembag struct {
 	loc    string
 	gemini bool
 	url    string
+	prompt string // address of the input line being answered
+	input  string
 }
 type signal struct {
 	op   int
@@ -0,0 +1,315 @@
+// Package epub exports capsule pages as an EPUB 3 book for e-readers.
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/shrmpy/gmi"
+	"github.com/shrmpy/gmi/html"
+)
+
+// Book is the ordered set of pages, one chapter per page
+type Book struct {
+	Title    string
+	Author   string
+	Lang     string
+	CSS      string // defaults to html.DefaultCSS
+	chapters []*chapter
+	index    map[string]*chapter // page address to chapter
+}
+
+type chapter struct {
+	addr  *url.URL
+	file  string
+	title string
+	tree  *gmi.Tree
+}
+
+func NewBook(title string) *Book {
+	return &Book{Title: title, Lang: "en", index: make(map[string]*chapter)}
+}
+
+// Add appends the page as the next chapter, the address is used to
+// rewrite links between chapters (duplicates are ignored)
+func (b *Book) Add(addr *url.URL, tree *gmi.Tree) {
+	var key = pageKey(addr)
+	if _, ok := b.index[key]; ok {
+		return
+	}
+	ch := &chapter{
+		addr:  addr,
+		file:  fmt.Sprintf("ch%03d.xhtml", len(b.chapters)+1),
+		title: tree.Title(),
+		tree:  tree,
+	}
+	if ch.title == "" {
+		ch.title = addr.Path
+		if ch.title == "" || ch.title == "/" {
+			ch.title = addr.Host
+		}
+	}
+	b.chapters = append(b.chapters, ch)
+	b.index[key] = ch
+}
+
+// Len is the count of chapters
+func (b *Book) Len() int {
+	return len(b.chapters)
+}
+
+// WriteTo writes the EPUB container (zip)
+func (b *Book) WriteTo(w io.Writer) (int64, error) {
+	var (
+		buf bytes.Buffer
+		now = time.Now()
+		zw  = zip.NewWriter(&buf)
+	)
+	// the mimetype entry must be first, uncompressed and without the
+	// extra field or data descriptor (raw with the checksum up front)
+	mt, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE([]byte(mimetype)),
+		CompressedSize64:   uint64(len(mimetype)),
+		UncompressedSize64: uint64(len(mimetype)),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err = io.WriteString(mt, mimetype); err != nil {
+		return 0, err
+	}
+
+	var files = []struct {
+		name string
+		fill func(io.Writer) error
+	}{
+		{"META-INF/container.xml", func(w io.Writer) error {
+			_, err := io.WriteString(w, containerXML)
+			return err
+		}},
+		{"OEBPS/content.opf", b.writePackage},
+		{"OEBPS/nav.xhtml", b.writeNav},
+		{"OEBPS/style.css", func(w io.Writer) error {
+			_, err := io.WriteString(w, b.css())
+			return err
+		}},
+	}
+	for _, ch := range b.chapters {
+		ch := ch
+		files = append(files, struct {
+			name string
+			fill func(io.Writer) error
+		}{"OEBPS/" + ch.file, func(w io.Writer) error { return b.writeChapter(w, ch) }})
+	}
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return 0, err
+		}
+		if err = f.fill(fw); err != nil {
+			return 0, fmt.Errorf("EPUB %s, %w", f.name, err)
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
+
+func (b *Book) css() string {
+	if b.CSS != "" {
+		return b.CSS
+	}
+	return html.DefaultCSS
+}
+
+// links to pages of the book become links to chapters
+func (b *Book) rewrite(from *chapter) func(*url.URL) string {
+	return func(lu *url.URL) string {
+		var abs = from.addr.ResolveReference(lu)
+		if ch, ok := b.index[pageKey(abs)]; ok {
+			if abs.Fragment != "" {
+				return ch.file + "#" + abs.Fragment
+			}
+			return ch.file
+		}
+		return abs.String()
+	}
+}
+
+func (b *Book) writeChapter(w io.Writer, ch *chapter) error {
+	var (
+		body strings.Builder
+		rdr  = &html.Renderer{Rewrite: b.rewrite(ch), IDs: true}
+	)
+	if err := rdr.Render(&body, ch.tree); err != nil {
+		return err
+	}
+	return chapterTemplate.Execute(w, map[string]string{
+		"Lang":  b.Lang,
+		"Title": ch.title,
+		"Body":  body.String(),
+	})
+}
+
+// entry of the table of contents
+type navEntry struct {
+	Title    string
+	Href     string
+	Children []navEntry
+}
+
+// table of contents from the chapters and their headings
+func (b *Book) writeNav(w io.Writer) error {
+	var toc []navEntry
+	for _, ch := range b.chapters {
+		entry := navEntry{Title: ch.title, Href: ch.file}
+		var outline = ch.tree.Outline()
+		if len(outline) == 1 && strings.TrimSpace(outline[0].Heading.Heading) == ch.title {
+			// the chapter title is the top heading already
+			outline = outline[0].Sections
+		}
+		entry.Children = sections(ch.file, outline)
+		toc = append(toc, entry)
+	}
+	return navTemplate.Execute(w, map[string]interface{}{
+		"Lang":  b.Lang,
+		"Title": b.Title,
+		"TOC":   toc,
+	})
+}
+
+func sections(file string, secs []*gmi.Section) []navEntry {
+	var entries []navEntry
+	for _, sec := range secs {
+		entries = append(entries, navEntry{
+			Title:    strings.TrimSpace(sec.Heading.Heading),
+			Href:     file + "#" + html.HeadingID(sec.Heading),
+			Children: sections(file, sec.Sections),
+		})
+	}
+	return entries
+}
+
+func (b *Book) writePackage(w io.Writer) error {
+	var (
+		files []string
+		sum   = sha1.New()
+	)
+	for _, ch := range b.chapters {
+		files = append(files, ch.file)
+		io.WriteString(sum, ch.addr.String())
+	}
+	// stable identifier for the same set of pages
+	var id = fmt.Sprintf("%x", sum.Sum(nil))
+	return packageTemplate.Execute(w, map[string]interface{}{
+		"ID":       fmt.Sprintf("urn:uuid:%s-%s-5%s-a%s-%s", id[0:8], id[8:12], id[13:16], id[17:20], id[20:32]),
+		"Title":    b.Title,
+		"Author":   b.Author,
+		"Lang":     b.Lang,
+		"Modified": time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		"Files":    files,
+	})
+}
+
+// address without the fragment identifies the page
+func pageKey(lu *url.URL) string {
+	var cp = *lu
+	cp.Fragment = ""
+	cp.RawFragment = ""
+	if cp.Scheme == "gemini" && cp.Port() == "" {
+		cp.Host += ":1965"
+	}
+	if cp.Path == "" {
+		cp.Path = "/"
+	}
+	return cp.String()
+}
+
+const mimetype = "application/epub+zip"
+
+const containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+var funcs = template.FuncMap{"xml": xmlEscape}
+
+var packageTemplate = template.Must(template.New("opf").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid" xml:lang="{{xml .Lang}}">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="bookid">{{.ID}}</dc:identifier>
+    <dc:title>{{xml .Title}}</dc:title>
+    <dc:language>{{xml .Lang}}</dc:language>
+{{- if .Author}}
+    <dc:creator>{{xml .Author}}</dc:creator>
+{{- end}}
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="css" href="style.css" media-type="text/css"/>
+{{- range $i, $f := .Files}}
+    <item id="c{{$i}}" href="{{$f}}" media-type="application/xhtml+xml"/>
+{{- end}}
+  </manifest>
+  <spine>
+{{- range $i, $f := .Files}}
+    <itemref idref="c{{$i}}"/>
+{{- end}}
+  </spine>
+</package>
+`))
+
+var navTemplate = template.Must(template.New("nav").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{xml .Lang}}" lang="{{xml .Lang}}">
+<head>
+<title>{{xml .Title}}</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+<nav epub:type="toc" id="toc">
+<h1>{{xml .Title}}</h1>
+{{template "entries" .TOC}}
+</nav>
+</body>
+</html>
+{{define "entries"}}<ol>
+{{- range .}}
+<li><a href="{{xml .Href}}">{{xml .Title}}</a>{{if .Children}}
+{{template "entries" .Children}}{{end}}</li>
+{{- end}}
+</ol>{{end}}
+`))
+
+var chapterTemplate = template.Must(template.New("chapter").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="{{xml .Lang}}" lang="{{xml .Lang}}">
+<head>
+<title>{{xml .Title}}</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+{{.Body}}</body>
+</html>
+`))
+
+var xmlReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&#34;", "'", "&#39;")
+
+func xmlEscape(s string) string {
+	return xmlReplacer.Replace(s)
+}
@@ -0,0 +1,80 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"net/url"
+	"testing"
+
+	"github.com/shrmpy/gmi"
+)
+
+func testBook(t *testing.T) []byte {
+	t.Helper()
+	tree, err := gmi.Parse("# Start\n=> /next.gmi Next\n")
+	if err != nil {
+		t.Fatalf("Parse, %v", err)
+	}
+	var book = NewBook("Test")
+	book.Add(&url.URL{Scheme: "gemini", Host: "example.org", Path: "/"}, tree)
+	var buf bytes.Buffer
+	if _, err = book.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo, %v", err)
+	}
+	return buf.Bytes()
+}
+
+// OCF: the mimetype is the first entry, stored, without extra field
+// so the readers find the type at a fixed offset
+func TestWriteToMimetype(t *testing.T) {
+	var out = testBook(t)
+	if len(out) < 58 {
+		t.Fatalf("book of %d bytes", len(out))
+	}
+	var header = []struct {
+		name string
+		at   int
+		want uint16
+	}{
+		{"flags", 6, 0},
+		{"method", 8, zip.Store},
+		{"name length", 26, 8},
+		{"extra length", 28, 0},
+	}
+	if !bytes.Equal(out[:4], []byte("PK\x03\x04")) {
+		t.Errorf("signature %q, want local file header", out[:4])
+	}
+	for _, h := range header {
+		if got := binary.LittleEndian.Uint16(out[h.at:]); got != h.want {
+			t.Errorf("mimetype %s %d, want %d", h.name, got, h.want)
+		}
+	}
+	if got, want := string(out[30:58]), "mimetypeapplication/epub+zip"; got != want {
+		t.Errorf("bytes 30-58 %q, want %q", got, want)
+	}
+}
+
+func TestWriteToEntries(t *testing.T) {
+	var out = testBook(t)
+	zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatalf("zip, %v", err)
+	}
+	var want = []string{
+		"mimetype",
+		"META-INF/container.xml",
+		"OEBPS/content.opf",
+		"OEBPS/nav.xhtml",
+		"OEBPS/style.css",
+		"OEBPS/ch001.xhtml",
+	}
+	if len(zr.File) != len(want) {
+		t.Fatalf("entries %d, want %d", len(zr.File), len(want))
+	}
+	for i, f := range zr.File {
+		if f.Name != want[i] {
+			t.Errorf("entry %d %s, want %s", i, f.Name, want[i])
+		}
+	}
+}
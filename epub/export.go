@@ -0,0 +1,160 @@
+package epub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/shrmpy/gmi"
+)
+
+// Exporter collects the pages of a capsule (or a directory) into a book
+type Exporter struct {
+	Client *gmi.Client
+	Depth  int    // link hops followed from the start page
+	Title  string // defaults to the title of the first page
+}
+
+// FromURL fetches the start page and follows links on the same capsule
+// (breadth first) until the depth is reached
+func (e *Exporter) FromURL(ctx context.Context, start string) (*Book, error) {
+	var first, err = gmi.Format(start, "")
+	if err != nil {
+		return nil, fmt.Errorf("Export start URL, %w", err)
+	}
+	var (
+		book  = NewBook(e.Title)
+		seen  = map[string]bool{pageKey(first): true}
+		queue = []*url.URL{first}
+	)
+	for hop := 0; hop <= e.Depth && len(queue) > 0; hop++ {
+		var next []*url.URL
+		for _, lu := range queue {
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+			addr, tree, err := e.fetch(ctx, lu)
+			if err != nil {
+				if book.Len() == 0 {
+					return nil, err
+				}
+				// broken links do not stop the export
+				log.Printf("INFO export skipped %s, %v", lu, err)
+				continue
+			}
+			book.Add(addr, tree)
+			for _, ln := range tree.Links() {
+				if ln.URL == nil {
+					continue
+				}
+				// with the default port, the same address as the dial
+				abs, err := gmi.Format(addr.ResolveReference(ln.URL).String(), "")
+				if err != nil || !sameCapsule(first, abs) || seen[pageKey(abs)] {
+					continue
+				}
+				seen[pageKey(abs)] = true
+				next = append(next, abs)
+			}
+		}
+		queue = next
+	}
+	e.entitle(book)
+	return book, nil
+}
+
+func (e *Exporter) fetch(ctx context.Context, lu *url.URL) (*url.URL, *gmi.Tree, error) {
+	ctrl, rdr, err := e.Client.Dial(ctx, lu)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer ctrl.Close()
+	buf, err := io.ReadAll(rdr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Export read %s, %w", lu, err)
+	}
+	// the address after redirects resolves the relative links
+	var addr = lu
+	if ctrl.URL() != nil {
+		addr = ctrl.URL()
+	}
+	if !strings.HasPrefix(ctrl.Meta(), "text/gemini") {
+		// other text is kept as preformatted
+		tree, err := gmi.NewDocument().Pre("", string(buf)).Tree()
+		return addr, tree, err
+	}
+	tree, err := gmi.Parse(string(buf))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Export parse %s, %w", lu, err)
+	}
+	return addr, tree, nil
+}
+
+// FromDir reads the .gmi files of the directory, links between the
+// files become links between chapters (depth is not used). The
+// directory is the root of the links (/about.gmi), the top index.gmi
+// is the first chapter.
+func (e *Exporter) FromDir(dir string) (*Book, error) {
+	var names []string
+	err := fs.WalkDir(os.DirFS(dir), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.ToLower(path.Ext(name)) == ".gmi" {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Export directory, %w", err)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return names[i] == "index.gmi" && names[j] != "index.gmi"
+	})
+	var book = NewBook(e.Title)
+	for _, name := range names {
+		buf, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		tree, err := gmi.Parse(string(buf))
+		if err != nil {
+			return nil, fmt.Errorf("Export parse %s, %w", name, err)
+		}
+		var addr = &url.URL{Scheme: "file", Path: "/" + name}
+		book.Add(addr, tree)
+		if path.Base(name) == "index.gmi" {
+			// links to the directory (/ or sub/) open the index
+			var folder = *addr
+			folder.Path = strings.TrimSuffix(addr.Path, "index.gmi")
+			book.index[pageKey(&folder)] = book.index[pageKey(addr)]
+		}
+	}
+	e.entitle(book)
+	return book, nil
+}
+
+// the first chapter names the book when the title is missing
+func (e *Exporter) entitle(b *Book) {
+	if b.Title == "" && b.Len() > 0 {
+		b.Title = b.chapters[0].title
+	}
+}
+
+func sameCapsule(a, b *url.URL) bool {
+	return b.Scheme == a.Scheme && strings.EqualFold(b.Hostname(), a.Hostname()) && port(b) == port(a)
+}
+
+func port(lu *url.URL) string {
+	if p := lu.Port(); p != "" {
+		return p
+	}
+	return "1965"
+}
@@ -0,0 +1,119 @@
+package epub
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shrmpy/gmi"
+	"github.com/shrmpy/gmi/server"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	var dir = t.TempDir()
+	for name, text := range files {
+		var p = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFromDir(t *testing.T) {
+	var dir = writeFiles(t, map[string]string{
+		"about.gmi":     "# About\n=> / Home\n",
+		"index.gmi":     "# Home\n=> /about.gmi About\n=> sub/ Sub\n",
+		"sub/index.gmi": "# Sub\n=> /about.gmi#team Team\n=> ../index.gmi Up\n=> post.gmi Post\n",
+		"sub/post.gmi":  "# Post\n=> https://example.org/ Away\n",
+	})
+	book, err := (&Exporter{}).FromDir(dir)
+	if err != nil {
+		t.Fatalf("FromDir, %v", err)
+	}
+	if book.Title != "Home" || book.chapters[0].title != "Home" {
+		t.Errorf("first chapter %q of book %q, want the index", book.chapters[0].title, book.Title)
+	}
+	var chapter = make(map[string]*chapter)
+	for _, ch := range book.chapters {
+		chapter[ch.title] = ch
+	}
+	var tests = []struct {
+		from string
+		link string
+		want string
+	}{
+		{"Home", "/about.gmi", chapter["About"].file},
+		{"Home", "sub/", chapter["Sub"].file},
+		{"About", "/", chapter["Home"].file},
+		{"Sub", "/about.gmi#team", chapter["About"].file + "#team"},
+		{"Sub", "../index.gmi", chapter["Home"].file},
+		{"Sub", "post.gmi", chapter["Post"].file},
+		{"Post", "https://example.org/", "https://example.org/"},
+	}
+	for _, tt := range tests {
+		lu, _ := url.Parse(tt.link)
+		if got := book.rewrite(chapter[tt.from])(lu); got != tt.want {
+			t.Errorf("%s link %s is %s, want %s", tt.from, tt.link, got, tt.want)
+		}
+	}
+}
+
+type acceptAll struct{}
+
+func (acceptAll) ISV() gmi.Mask      { return gmi.AcceptUAE | gmi.AcceptLCN }
+func (acceptAll) KnownHosts() string { return "" }
+
+// absolute links without the port are chapters of the capsule too
+func TestFromURLDefaultPort(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:1965")
+	if err != nil {
+		t.Skipf("Gemini port is busy, %v", err)
+	}
+	certPEM, keyPEM, err := server.NewCertificate(server.CertOptions{Hosts: []string{"localhost"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rt = server.NewRouter()
+	var page = func(body string) server.HandlerFunc {
+		return func(w server.ResponseWriter, r *server.Request) {
+			w.WriteHeader(server.StatusSuccess, "text/gemini")
+			w.Write([]byte(body))
+		}
+	}
+	rt.HandleFunc("/", page("# Start\n=> gemini://localhost/abs.gmi Absolute\n=> rel.gmi Relative\n"))
+	rt.HandleFunc("/abs.gmi", page("# Absolute\n"))
+	rt.HandleFunc("/rel.gmi", page("# Relative\n"))
+	var cfg = &tls.Config{Certificates: []tls.Certificate{pair}}
+	var srv = &server.Server{Handler: rt, TLSConfig: cfg}
+	go srv.Serve(tls.NewListener(ln, cfg))
+	defer srv.Shutdown(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var ex = &Exporter{Client: gmi.NewClient(acceptAll{}), Depth: 1}
+	book, err := ex.FromURL(ctx, "gemini://localhost/")
+	if err != nil {
+		t.Fatalf("FromURL, %v", err)
+	}
+	var titles []string
+	for _, ch := range book.chapters {
+		titles = append(titles, ch.title)
+	}
+	if len(titles) != 3 || titles[0] != "Start" || titles[1] != "Absolute" || titles[2] != "Relative" {
+		t.Errorf("chapters %q, want Start, Absolute and Relative", titles)
+	}
+}
@@ -5,53 +5,58 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/url"
+	"strings"
 )
 import "github.com/shrmpy/gmi"
+import "github.com/shrmpy/gmi/markdown"
 
 func main() {
 	var cp = flag.String("cap", "gemini://gemini.circumlunar.space", "Capsule address")
+	var refs = flag.Bool("refs", false, "Reference-style links")
 	flag.Parse()
 
 	var cfg = &config{}
-	var md = transform(*cp, cfg)
+	var md = transform(*cp, cfg, *refs)
 	fmt.Println(md)
 }
-func transform(capsule string, cfg *config) string {
+func transform(capsule string, cfg *config, refs bool) string {
 	var (
-		err error
-		req *url.URL
-		rdr *bufio.Reader
-		md  string
+		err  error
+		req  *url.URL
+		rdr  *bufio.Reader
+		buf  []byte
+		tree *gmi.Tree
+		sb   strings.Builder
 	)
-	var ctrl = gmi.NewControl(context.Background())
-	ctrl.Attach(gmi.LinkLine, rewriteLink)
-	ctrl.Attach(gmi.PlainLine, rewritePlain)
+	var client = gmi.NewClient(cfg)
 	if req, err = gmi.Format(capsule, ""); err != nil {
 		log.Fatalf("DEBUG Capsule URL, %v", err)
 	}
-	if rdr, err = ctrl.Dial(req, cfg); err != nil {
+	ctrl, rdr, err := client.Dial(context.Background(), req)
+	if err != nil {
 		log.Fatalf("DEBUG Dial, %v", err)
 	}
 	defer ctrl.Close()
-	if md, err = ctrl.Retrieve(rdr); err != nil {
-		log.Fatalf("DEBUG Retrieve, %v", err)
+	if buf, err = ioutil.ReadAll(rdr); err != nil {
+		log.Fatalf("DEBUG Read, %v", err)
 	}
-	return md
-}
-func rewriteLink(n gmi.Node) string {
-	var lnk = n.(*gmi.LinkNode)
-	var name = lnk.Friendly
-	var lu = lnk.URL
-	if name == "" {
-		name = lu.String()
+	if tree, err = gmi.Parse(string(buf)); err != nil {
+		log.Fatalf("DEBUG Parse, %v", err)
 	}
-	// markdown of hyperlink
-	return fmt.Sprintf("[=> %s](%s)\n", name, lu)
-}
-func rewritePlain(n gmi.Node) string {
-	return fmt.Sprintf("%s\n", n)
+	// relative links are resolved against the capsule address
+	var md = &markdown.Renderer{
+		ReferenceLinks: refs,
+		Rewrite: func(lu *url.URL) string {
+			return req.ResolveReference(lu).String()
+		},
+	}
+	if err = md.Render(&sb, tree); err != nil {
+		log.Fatalf("DEBUG Render, %v", err)
+	}
+	return sb.String()
 }
 
 type config struct{}
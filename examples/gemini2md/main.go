@@ -1,8 +1,6 @@
 package main
 
 import (
-	"bufio"
-	"context"
 	"flag"
 	"fmt"
 	"io/fs"
@@ -12,20 +10,20 @@ import (
 	"strings"
 )
 import "github.com/shrmpy/gmi"
+import "github.com/shrmpy/gmi/markdown"
 
 func main() {
 	var (
 		errp error
 		abs  string
 		dir  = flag.String("dir", "", "Work directory with Gemtext files")
+		refs = flag.Bool("refs", false, "Reference-style links")
 	)
 	flag.Parse()
 	if abs, errp = filepath.Abs(*dir); errp != nil {
 		log.Fatalf("Unknown path, %v", errp)
 	}
-	var ctrl = gmi.NewControl(context.Background())
-	ctrl.Attach(gmi.LinkLine, rewriteLink)
-	ctrl.Attach(gmi.PlainLine, rewritePlain)
+	var md = &markdown.Renderer{ReferenceLinks: *refs}
 	filepath.WalkDir(abs, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			log.Printf("INFO walk halted, %v", err)
@@ -40,27 +38,28 @@ func main() {
 			return nil
 		}
 		var (
-			errs  error
-			rdr   *bufio.Reader
-			ifile *os.File
-			outf  string
-			md    string
+			errs error
+			buf  []byte
+			tree *gmi.Tree
+			outf string
+			sb   strings.Builder
 		)
-		if ifile, errs = os.Open(path); errs != nil {
+		log.Printf("INFO reading, %s", d.Name())
+		if buf, errs = os.ReadFile(path); errs != nil {
 			log.Printf("ERROR file, %v", errs)
 			return errs
 		}
-		defer ifile.Close()
-		log.Printf("INFO reading, %s", d.Name())
-		rdr = bufio.NewReader(ifile)
-
-		if md, errs = ctrl.Retrieve(rdr); errs != nil {
-			log.Printf("ERROR Retrieve, %v", errs)
+		if tree, errs = gmi.Parse(string(buf)); errs != nil {
+			log.Printf("ERROR Parse, %v", errs)
+			return errs
+		}
+		if errs = md.Render(&sb, tree); errs != nil {
+			log.Printf("ERROR Render, %v", errs)
 			return errs
 		}
 		outf = fmt.Sprintf("%s.md", strings.TrimSuffix(path, ".gmi"))
-		log.Printf("INFO writing, %s : %d", outf, len(md))
-		errs = os.WriteFile(outf, []byte(md), d.Type())
+		log.Printf("INFO writing, %s : %d", outf, sb.Len())
+		errs = os.WriteFile(outf, []byte(sb.String()), d.Type())
 		if errs != nil {
 			log.Printf("ERROR output file, %v", errs)
 			return errs
@@ -69,18 +68,3 @@ func main() {
 		return nil
 	})
 }
-func rewriteLink(n gmi.Node) string {
-	var (
-		lnk  = n.(*gmi.LinkNode)
-		name = lnk.Friendly
-		lu   = lnk.URL
-	)
-	if name == "" {
-		name = lu.String()
-	}
-	// markdown of hyperlink
-	return fmt.Sprintf("[=> %s](%s)\n", name, lu)
-}
-func rewritePlain(n gmi.Node) string {
-	return fmt.Sprintf("%s\n", n)
-}
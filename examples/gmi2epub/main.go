@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+)
+import "github.com/shrmpy/gmi"
+import "github.com/shrmpy/gmi/epub"
+
+func main() {
+	var (
+		err  error
+		book *epub.Book
+		cp   = flag.String("cap", "", "Capsule address of the start page")
+		dir  = flag.String("dir", "", "Work directory with Gemtext files")
+		dep  = flag.Int("depth", 1, "Link hops followed from the start page")
+		out  = flag.String("out", "capsule.epub", "Output EPUB file")
+		ttl  = flag.String("title", "", "Book title (default is the first page title)")
+	)
+	flag.Parse()
+
+	var exp = &epub.Exporter{
+		Client: gmi.NewClient(&config{}),
+		Depth:  *dep,
+		Title:  *ttl,
+	}
+	switch {
+	case *dir != "":
+		book, err = exp.FromDir(*dir)
+	case *cp != "":
+		book, err = exp.FromURL(context.Background(), *cp)
+	default:
+		log.Fatalf("DEBUG Either -cap or -dir is required")
+	}
+	if err != nil {
+		log.Fatalf("DEBUG Export, %v", err)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("DEBUG Output file, %v", err)
+	}
+	defer f.Close()
+	if _, err = book.WriteTo(f); err != nil {
+		log.Fatalf("DEBUG Write, %v", err)
+	}
+	log.Printf("INFO wrote %d chapters, %s", book.Len(), *out)
+}
+
+type config struct{}
+
+func (c *config) ISV() gmi.Mask {
+	return gmi.AcceptUAE | gmi.AcceptLCN
+}
+func (c *config) KnownHosts() string {
+	return "known_capsules"
+}
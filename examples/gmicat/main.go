@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+)
+import "github.com/shrmpy/gmi"
+import "github.com/shrmpy/gmi/ansi"
+
+// print Gemtext files (or stdin) formatted for the terminal,
+// e.g. gmicat -color index.gmi | less -R
+func main() {
+	var (
+		wd    = flag.Int("width", 80, "Columns to wrap text lines")
+		color = flag.Bool("color", false, "ANSI colors")
+		pager = flag.Bool("pager", false, "Page the output with less -R")
+	)
+	flag.Parse()
+
+	var (
+		err  error
+		out  io.Writer = os.Stdout
+		less *exec.Cmd
+		rdr  = &ansi.Renderer{Width: *wd, Color: *color}
+	)
+	if *pager {
+		less = exec.Command("less", "-R")
+		less.Stdout, less.Stderr = os.Stdout, os.Stderr
+		var pipe io.WriteCloser
+		if pipe, err = less.StdinPipe(); err != nil {
+			log.Fatalf("ERROR pager, %v", err)
+		}
+		if err = less.Start(); err != nil {
+			log.Fatalf("ERROR pager, %v", err)
+		}
+		out = pipe
+		defer func() {
+			pipe.Close()
+			less.Wait()
+		}()
+	}
+	var files = flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, name := range files {
+		var buf []byte
+		if name == "-" {
+			buf, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			buf, err = os.ReadFile(name)
+		}
+		if err != nil {
+			log.Printf("ERROR read, %v", err)
+			continue
+		}
+		tree, err := gmi.Parse(string(buf))
+		if err != nil {
+			log.Printf("ERROR Parse, %v", err)
+			continue
+		}
+		if err = rdr.Render(out, tree); err != nil {
+			log.Printf("ERROR Render, %v", err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+import "github.com/shrmpy/gmi"
+import "github.com/shrmpy/gmi/markdown"
+
+func main() {
+	var (
+		errp error
+		abs  string
+		dir  = flag.String("dir", "", "Work directory with Markdown files")
+	)
+	flag.Parse()
+	if abs, errp = filepath.Abs(*dir); errp != nil {
+		log.Fatalf("Unknown path, %v", errp)
+	}
+	filepath.WalkDir(abs, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("INFO walk halted, %v", err)
+			return err
+		}
+		if d.IsDir() {
+			log.Printf("INFO dir, %s", d.Name())
+			return nil
+		}
+		if strings.ToLower(filepath.Ext(path)) != ".md" {
+			log.Printf("INFO non .md skipped, %s", d.Name())
+			return nil
+		}
+		var (
+			errs error
+			buf  []byte
+			tree *gmi.Tree
+			outf string
+			sb   strings.Builder
+		)
+		log.Printf("INFO reading, %s", d.Name())
+		if buf, errs = os.ReadFile(path); errs != nil {
+			log.Printf("ERROR file, %v", errs)
+			return errs
+		}
+		if tree, errs = markdown.Parse(string(buf)); errs != nil {
+			log.Printf("ERROR Parse, %v", errs)
+			return errs
+		}
+		tree.WriteTo(&sb)
+		outf = fmt.Sprintf("%s.gmi", strings.TrimSuffix(path, filepath.Ext(path)))
+		log.Printf("INFO writing, %s : %d", outf, sb.Len())
+		errs = os.WriteFile(outf, []byte(sb.String()), 0644)
+		if errs != nil {
+			log.Printf("ERROR output file, %v", errs)
+			return errs
+		}
+
+		return nil
+	})
+}
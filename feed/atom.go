@@ -0,0 +1,168 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Atom document shape (only the elements which the Feed keeps)
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Author   *atomAuthor `xml:"author,omitempty"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published,omitempty"`
+	Summary   string     `xml:"summary,omitempty"`
+	Links     []atomLink `xml:"link"`
+}
+
+// ParseAtom reads the Atom feed, the page is the address the feed was
+// fetched from (relative links are resolved against it)
+func ParseAtom(r io.Reader, page *url.URL) (*Feed, error) {
+	var af atomFeed
+	if err := xml.NewDecoder(r).Decode(&af); err != nil {
+		return nil, fmt.Errorf("Atom decode, %w", err)
+	}
+	var f = &Feed{
+		Title:    strings.TrimSpace(af.Title),
+		Subtitle: strings.TrimSpace(af.Subtitle),
+		URL:      alternate(af.Links, page),
+		Updated:  atomTime(af.Updated),
+	}
+	if f.URL == nil {
+		f.URL = page
+	}
+	if af.Author != nil {
+		f.Author = af.Author.Name
+	}
+	for _, ae := range af.Entries {
+		var en = Entry{
+			Title:   strings.TrimSpace(ae.Title),
+			URL:     alternate(ae.Links, f.URL),
+			Updated: atomTime(ae.Updated),
+			Summary: strings.TrimSpace(ae.Summary),
+		}
+		if en.Updated.IsZero() {
+			en.Updated = atomTime(ae.Published)
+		}
+		if en.URL == nil {
+			// some feeds only carry the permalink as the id (not a urn)
+			if lu, err := url.Parse(strings.TrimSpace(ae.ID)); err == nil && lu.IsAbs() && lu.Host != "" {
+				en.URL = lu
+			} else {
+				continue
+			}
+		}
+		f.Entries = append(f.Entries, en)
+	}
+	f.sort()
+	return f, nil
+}
+
+// the alternate link (or the first without a rel)
+func alternate(links []atomLink, page *url.URL) *url.URL {
+	for _, ln := range links {
+		if ln.Rel != "" && ln.Rel != "alternate" {
+			continue
+		}
+		lu, err := url.Parse(strings.TrimSpace(ln.Href))
+		if err != nil {
+			continue
+		}
+		if page != nil {
+			return page.ResolveReference(lu)
+		}
+		return lu
+	}
+	return nil
+}
+
+// RFC 3339 timestamps, a date alone is accepted too
+func atomTime(text string) time.Time {
+	text = strings.TrimSpace(text)
+	if ts, err := time.Parse(time.RFC3339, text); err == nil {
+		return ts
+	}
+	if ts, err := time.Parse(dateLayout, text); err == nil {
+		return ts
+	}
+	return time.Time{}
+}
+
+// WriteAtom generates the Atom XML of the feed, self is the address
+// where the Atom file is published (optional)
+func (f *Feed) WriteAtom(w io.Writer, self *url.URL) error {
+	if f.URL == nil {
+		return fmt.Errorf("Atom feed requires the page URL")
+	}
+	var updated = f.Updated
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	var af = atomFeed{
+		ID:       f.URL.String(),
+		Title:    f.Title,
+		Subtitle: f.Subtitle,
+		Updated:  updated.UTC().Format(time.RFC3339),
+		Links:    []atomLink{{Href: f.URL.String(), Rel: "alternate", Type: "text/gemini"}},
+	}
+	if self != nil {
+		af.Links = append(af.Links, atomLink{Href: self.String(), Rel: "self", Type: "application/atom+xml"})
+	}
+	// an author is required by Atom, the capsule host stands in
+	var author = f.Author
+	if author == "" {
+		author = f.URL.Hostname()
+	}
+	af.Author = &atomAuthor{Name: author}
+	for _, en := range f.Entries {
+		af.Entries = append(af.Entries, atomEntry{
+			ID:      en.URL.String(),
+			Title:   en.Title,
+			Updated: en.Updated.UTC().Format(time.RFC3339),
+			Summary: en.Summary,
+			Links:   []atomLink{{Href: en.URL.String(), Rel: "alternate", Type: "text/gemini"}},
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	var enc = xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(af); err != nil {
+		return fmt.Errorf("Atom encode, %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// IsAtom reports whether the MIME type (from the response header) is
+// an Atom or generic XML document
+func IsAtom(meta string) bool {
+	var mt = strings.ToLower(strings.TrimSpace(strings.SplitN(meta, ";", 2)[0]))
+	return mt == "application/atom+xml" || mt == "application/xml" || mt == "text/xml"
+}
@@ -0,0 +1,188 @@
+package feed
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const atomDoc = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <id>gemini://capsule.example/log/</id>
+  <title> Gemlog </title>
+  <subtitle>Notes</subtitle>
+  <updated>2022-05-01T00:00:00Z</updated>
+  <author><name>Ann</name></author>
+  <link href="atom.xml" rel="self"/>
+  <link href="/log/" rel="alternate"/>
+  <entry>
+    <id>gemini://capsule.example/log/old.gmi</id>
+    <title>Old</title>
+    <updated>2022-01-02T10:00:00Z</updated>
+    <link href="old.gmi"/>
+  </entry>
+  <entry>
+    <id>urn:uuid:1</id>
+    <title>Newest</title>
+    <updated>2022-06-03T08:00:00+02:00</updated>
+    <summary> First lines </summary>
+    <link rel="edit" href="/edit/3"/>
+    <link rel="alternate" href="gemini://other.example/new.gmi"/>
+  </entry>
+  <entry>
+    <id>gemini://capsule.example/log/by-id.gmi</id>
+    <title>Only the id</title>
+    <published>2022-03-04</published>
+  </entry>
+  <entry>
+    <id>urn:uuid:2</id>
+    <title>No address</title>
+    <updated>2022-04-04T00:00:00Z</updated>
+  </entry>
+</feed>`
+
+func TestParseAtom(t *testing.T) {
+	var page, _ = url.Parse("gemini://capsule.example/log/atom.xml")
+	f, err := ParseAtom(strings.NewReader(atomDoc), page)
+	if err != nil {
+		t.Fatalf("ParseAtom, %v", err)
+	}
+	var feed = []struct {
+		field string
+		got   string
+		want  string
+	}{
+		{"title", f.Title, "Gemlog"},
+		{"subtitle", f.Subtitle, "Notes"},
+		{"author", f.Author, "Ann"},
+		{"url", f.URL.String(), "gemini://capsule.example/log/"},
+		// the newest entry is more recent than the feed element
+		{"updated", f.Updated.UTC().Format(time.RFC3339), "2022-06-03T06:00:00Z"},
+	}
+	for _, tt := range feed {
+		if tt.got != tt.want {
+			t.Errorf("feed %s %q, want %q", tt.field, tt.got, tt.want)
+		}
+	}
+	// newest first, the entry without an address is dropped
+	var entries = []struct {
+		title   string
+		url     string
+		updated string
+		summary string
+	}{
+		{"Newest", "gemini://other.example/new.gmi", "2022-06-03", "First lines"},
+		{"Only the id", "gemini://capsule.example/log/by-id.gmi", "2022-03-04", ""},
+		{"Old", "gemini://capsule.example/log/old.gmi", "2022-01-02", ""},
+	}
+	if len(f.Entries) != len(entries) {
+		t.Fatalf("%d entries, want %d", len(f.Entries), len(entries))
+	}
+	for i, tt := range entries {
+		var en = f.Entries[i]
+		if en.Title != tt.title || en.URL.String() != tt.url || en.Updated.Format(dateLayout) != tt.updated || en.Summary != tt.summary {
+			t.Errorf("entry %d is %q %s %s %q, want %q %s %s %q", i, en.Title, en.URL, en.Updated.Format(dateLayout), en.Summary, tt.title, tt.url, tt.updated, tt.summary)
+		}
+	}
+}
+
+func TestParseAtomErrors(t *testing.T) {
+	var tests = []struct {
+		name string
+		doc  string
+	}{
+		{"not xml", "# gemtext\n"},
+		{"rss", `<rss version="2.0"><channel><title>T</title></channel></rss>`},
+		{"no namespace", `<feed><title>T</title></feed>`},
+	}
+	for _, tt := range tests {
+		if _, err := ParseAtom(strings.NewReader(tt.doc), nil); err == nil {
+			t.Errorf("%s: ParseAtom succeeded", tt.name)
+		}
+	}
+}
+
+func TestAtomTime(t *testing.T) {
+	var tests = []struct {
+		text string
+		want string
+	}{
+		{"2022-06-03T08:00:00+02:00", "2022-06-03T06:00:00Z"},
+		{" 2022-06-03T08:00:00Z ", "2022-06-03T08:00:00Z"},
+		{"2022-06-03", "2022-06-03T00:00:00Z"},
+		{"June 3, 2022", "0001-01-01T00:00:00Z"},
+		{"", "0001-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		if got := atomTime(tt.text).UTC().Format(time.RFC3339); got != tt.want {
+			t.Errorf("%q: time %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+// the written feed reads back with the same entries
+func TestWriteAtom(t *testing.T) {
+	var (
+		page, _ = url.Parse("gemini://capsule.example/log/")
+		self, _ = url.Parse("gemini://capsule.example/log/atom.xml")
+		first   = time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	)
+	var f = &Feed{Title: "Log & notes", URL: page, Entries: []Entry{
+		{Title: "Second <b>", URL: page.ResolveReference(&url.URL{Path: "b.gmi"}), Updated: first.AddDate(0, 0, 1), Summary: "s"},
+		{Title: "First", URL: page.ResolveReference(&url.URL{Path: "a.gmi"}), Updated: first},
+	}}
+	f.sort()
+	var sb strings.Builder
+	if err := f.WriteAtom(&sb, self); err != nil {
+		t.Fatalf("WriteAtom, %v", err)
+	}
+	for _, want := range []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<title>Log &amp; notes</title>`,
+		`<name>capsule.example</name>`,
+		`<updated>2022-06-02T00:00:00Z</updated>`,
+		`<link href="gemini://capsule.example/log/atom.xml" rel="self" type="application/atom+xml"></link>`,
+		`<title>Second &lt;b&gt;</title>`,
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("Atom %s does not contain %s", sb.String(), want)
+		}
+	}
+	back, err := ParseAtom(strings.NewReader(sb.String()), self)
+	if err != nil {
+		t.Fatalf("ParseAtom, %v", err)
+	}
+	if back.Title != f.Title || back.URL.String() != page.String() || len(back.Entries) != 2 {
+		t.Fatalf("read back %q %s with %d entries", back.Title, back.URL, len(back.Entries))
+	}
+	for i, en := range back.Entries {
+		var want = f.Entries[i]
+		if en.Title != want.Title || en.URL.String() != want.URL.String() || !en.Updated.Equal(want.Updated) || en.Summary != want.Summary {
+			t.Errorf("entry %d reads back as %+v, want %+v", i, en, want)
+		}
+	}
+	if err = (&Feed{Title: "no page"}).WriteAtom(&sb, nil); err == nil {
+		t.Errorf("WriteAtom without the page URL succeeded")
+	}
+}
+
+func TestIsAtom(t *testing.T) {
+	var tests = []struct {
+		meta string
+		want bool
+	}{
+		{"application/atom+xml", true},
+		{"Application/Atom+XML; charset=utf-8", true},
+		{"application/xml", true},
+		{"text/xml", true},
+		{"text/gemini", false},
+		{"application/rss+xml", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsAtom(tt.meta); got != tt.want {
+			t.Errorf("%q: IsAtom %v, want %v", tt.meta, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Package feed reads and writes the updates of gemlogs: the Gemini
+// subscription convention (gemfeed) and Atom feeds.
+package feed
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shrmpy/gmi"
+)
+
+// Feed is the gemlog with its entries (newest first)
+type Feed struct {
+	Title    string
+	Subtitle string
+	URL      *url.URL
+	Author   string
+	Updated  time.Time
+	Entries  []Entry
+}
+
+// Entry is one post of the gemlog
+type Entry struct {
+	Title   string
+	URL     *url.URL
+	Updated time.Time
+	Summary string
+}
+
+// ISO 8601 date which starts the link name of an entry
+const dateLayout = "2006-01-02"
+
+// Parse extracts the entries from the page (a link line whose name
+// starts with the date), the first heading is the feed title and a
+// level 2 heading right after it is the subtitle. Entry URLs are
+// resolved against the page address.
+func Parse(t *gmi.Tree, page *url.URL) (*Feed, error) {
+	if t == nil || t.Root == nil {
+		return nil, fmt.Errorf("Feed page is empty")
+	}
+	var f = &Feed{URL: page}
+	var headings int
+	for _, n := range t.Root.Nodes {
+		switch no := n.(type) {
+		case *gmi.HeadingNode:
+			headings++
+			var text = strings.TrimSpace(no.Heading)
+			if headings == 1 && no.Level == 1 {
+				f.Title = text
+			} else if headings == 2 && no.Level == 2 && f.Title != "" && len(f.Entries) == 0 {
+				f.Subtitle = text
+			}
+		case *gmi.LinkNode:
+			if en, ok := entry(no, page); ok {
+				f.Entries = append(f.Entries, en)
+			}
+		}
+	}
+	if f.Title == "" {
+		return nil, fmt.Errorf("Feed page requires a level 1 heading")
+	}
+	f.sort()
+	return f, nil
+}
+
+// link line is an entry when the name starts with the date
+func entry(n *gmi.LinkNode, page *url.URL) (Entry, bool) {
+	var name = strings.TrimSpace(n.Friendly)
+	if len(name) < len(dateLayout) || n.URL == nil {
+		return Entry{}, false
+	}
+	day, err := time.Parse(dateLayout, name[:len(dateLayout)])
+	if err != nil {
+		return Entry{}, false
+	}
+	// separators between the date and title are optional
+	var title = strings.TrimLeft(name[len(dateLayout):], " \t-–—:")
+	var lu = n.URL
+	if page != nil {
+		lu = page.ResolveReference(n.URL)
+	}
+	if title == "" {
+		title = lu.String()
+	}
+	return Entry{Title: title, URL: lu, Updated: day}, true
+}
+
+// Tree formats the feed as a subscription page
+func (f *Feed) Tree() (*gmi.Tree, error) {
+	var doc = gmi.NewDocument().Heading(1, f.Title)
+	if f.Subtitle != "" {
+		doc.Heading(2, f.Subtitle)
+	}
+	doc.Blank()
+	for _, en := range f.Entries {
+		var ref = en.URL.String()
+		if f.URL != nil {
+			ref = relative(f.URL, en.URL)
+		}
+		doc.Link(ref, en.Updated.Format(dateLayout)+" - "+en.Title)
+	}
+	return doc.Tree()
+}
+
+// FromDir builds the feed from the gemlog directory; index.gmi (when
+// present) supplies the title and entries, other .gmi files with a
+// date prefix in the file name (2022-06-01-title.gmi) are entries too.
+// The base is the capsule address of the directory.
+func FromDir(dir string, base *url.URL) (*Feed, error) {
+	if !strings.HasSuffix(base.Path, "/") {
+		var cp = *base
+		cp.Path += "/"
+		base = &cp
+	}
+	var f = &Feed{Title: filepath.Base(dir), URL: base}
+	if buf, err := os.ReadFile(filepath.Join(dir, "index.gmi")); err == nil {
+		tree, err := gmi.Parse(string(buf))
+		if err != nil {
+			return nil, fmt.Errorf("Feed index, %w", err)
+		}
+		if idx, err := Parse(tree, base); err == nil {
+			f.Title, f.Subtitle, f.Entries = idx.Title, idx.Subtitle, idx.Entries
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Feed index, %w", err)
+	}
+
+	var known = make(map[string]bool)
+	for _, en := range f.Entries {
+		known[en.URL.String()] = true
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Feed directory, %w", err)
+	}
+	for _, fi := range files {
+		if en, ok := fileEntry(dir, fi, base); ok && !known[en.URL.String()] {
+			f.Entries = append(f.Entries, en)
+		}
+	}
+	f.sort()
+	return f, nil
+}
+
+// dated .gmi file of the gemlog directory
+func fileEntry(dir string, fi fs.DirEntry, base *url.URL) (Entry, bool) {
+	var name = fi.Name()
+	if fi.IsDir() || strings.ToLower(filepath.Ext(name)) != ".gmi" || len(name) < len(dateLayout) {
+		return Entry{}, false
+	}
+	day, err := time.Parse(dateLayout, name[:len(dateLayout)])
+	if err != nil {
+		return Entry{}, false
+	}
+	var en = Entry{
+		URL:     base.ResolveReference(&url.URL{Path: name}),
+		Updated: day,
+		Title:   strings.TrimLeft(strings.TrimSuffix(name[len(dateLayout):], filepath.Ext(name)), "-_ "),
+	}
+	if buf, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+		if tree, err := gmi.Parse(string(buf)); err == nil && tree.Title() != "" {
+			en.Title = tree.Title()
+		}
+	}
+	if en.Title == "" {
+		en.Title = name
+	}
+	return en, true
+}
+
+// newest first, the feed is as recent as its newest entry
+func (f *Feed) sort() {
+	sort.SliceStable(f.Entries, func(i, j int) bool {
+		return f.Entries[i].Updated.After(f.Entries[j].Updated)
+	})
+	if len(f.Entries) > 0 && f.Entries[0].Updated.After(f.Updated) {
+		f.Updated = f.Entries[0].Updated
+	}
+}
+
+// path of the entry relative to the page (when on the same capsule)
+func relative(page *url.URL, lu *url.URL) string {
+	if lu.Scheme != page.Scheme || lu.Host != page.Host {
+		return lu.String()
+	}
+	var dir = page.Path[:strings.LastIndex(page.Path, "/")+1]
+	if strings.HasPrefix(lu.Path, dir) && lu.RawQuery == "" {
+		return strings.TrimPrefix(lu.Path, dir)
+	}
+	return lu.Path
+}
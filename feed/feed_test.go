@@ -0,0 +1,139 @@
+package feed
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shrmpy/gmi"
+)
+
+func TestParse(t *testing.T) {
+	var page, _ = url.Parse("gemini://capsule.example/log/index.gmi")
+	var tree, err = gmi.Parse(`# Gemlog
+## Notes on things
+
+=> 2022-01-02-old.gmi 2022-01-02 - Old post
+=> /about.gmi About
+=> gemini://other.example/x.gmi 2022-06-03: Elsewhere
+=> 2022-03-04.gmi 2022-03-04
+=> same-day-a.gmi 2022-03-04 Same day, first listed
+=> bad.gmi 2022-13-01 Not a date
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Parse(tree, page)
+	if err != nil {
+		t.Fatalf("Parse, %v", err)
+	}
+	if f.Title != "Gemlog" || f.Subtitle != "Notes on things" || f.Updated.Format(dateLayout) != "2022-06-03" {
+		t.Errorf("feed %q %q %s", f.Title, f.Subtitle, f.Updated.Format(dateLayout))
+	}
+	// newest first, entries of the same day keep the page order
+	var want = []struct {
+		title string
+		url   string
+		day   string
+	}{
+		{"Elsewhere", "gemini://other.example/x.gmi", "2022-06-03"},
+		{"gemini://capsule.example/log/2022-03-04.gmi", "gemini://capsule.example/log/2022-03-04.gmi", "2022-03-04"},
+		{"Same day, first listed", "gemini://capsule.example/log/same-day-a.gmi", "2022-03-04"},
+		{"Old post", "gemini://capsule.example/log/2022-01-02-old.gmi", "2022-01-02"},
+	}
+	if len(f.Entries) != len(want) {
+		t.Fatalf("%d entries, want %d", len(f.Entries), len(want))
+	}
+	for i, tt := range want {
+		var en = f.Entries[i]
+		if en.Title != tt.title || en.URL.String() != tt.url || en.Updated.Format(dateLayout) != tt.day {
+			t.Errorf("entry %d is %q %s %s, want %q %s %s", i, en.Title, en.URL, en.Updated.Format(dateLayout), tt.title, tt.url, tt.day)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	var tests = []struct {
+		name string
+		page string
+	}{
+		{"empty", ""},
+		{"no heading", "=> a.gmi 2022-01-01 Post\n"},
+		{"level 2 first", "## Notes\n=> a.gmi 2022-01-01 Post\n"},
+	}
+	for _, tt := range tests {
+		tree, err := gmi.Parse(tt.page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = Parse(tree, nil); err == nil {
+			t.Errorf("%s: Parse succeeded", tt.name)
+		}
+	}
+}
+
+// the subscription page lists the entries relative to the feed
+func TestTree(t *testing.T) {
+	var page, _ = url.Parse("gemini://capsule.example/log/")
+	tree, err := gmi.Parse("# Log\n## Sub\n=> b.gmi 2022-02-01 B\n=> /log/a.gmi 2022-01-01 A\n=> gemini://other.example/c.gmi 2022-03-01 C\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Parse(tree, page)
+	if err != nil {
+		t.Fatalf("Parse, %v", err)
+	}
+	out, err := f.Tree()
+	if err != nil {
+		t.Fatalf("Tree, %v", err)
+	}
+	var sb strings.Builder
+	out.WriteTo(&sb)
+	var want = "# Log\n## Sub\n\n=> gemini://other.example/c.gmi 2022-03-01 - C\n=> b.gmi 2022-02-01 - B\n=> a.gmi 2022-01-01 - A\n"
+	if sb.String() != want {
+		t.Errorf("page %q, want %q", sb.String(), want)
+	}
+}
+
+func TestFromDir(t *testing.T) {
+	var dir = t.TempDir()
+	var files = map[string]string{
+		"index.gmi":               "# My log\n=> 2022-01-01-listed.gmi 2022-01-01 Listed\n",
+		"2022-01-01-listed.gmi":   "# Listed in the index\n",
+		"2022-05-06-new-post.gmi": "# New post\ntext\n",
+		"2022-03-04_untitled.gmi": "no heading\n",
+		"notes.gmi":               "# Not dated\n",
+		"2022-02-02-image.png":    "png",
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var base, _ = url.Parse("gemini://capsule.example/log")
+	f, err := FromDir(dir, base)
+	if err != nil {
+		t.Fatalf("FromDir, %v", err)
+	}
+	if f.Title != "My log" || f.URL.String() != "gemini://capsule.example/log/" {
+		t.Errorf("feed %q %s", f.Title, f.URL)
+	}
+	var want = []struct {
+		title string
+		url   string
+	}{
+		{"New post", "gemini://capsule.example/log/2022-05-06-new-post.gmi"},
+		{"untitled", "gemini://capsule.example/log/2022-03-04_untitled.gmi"},
+		{"Listed", "gemini://capsule.example/log/2022-01-01-listed.gmi"},
+	}
+	if len(f.Entries) != len(want) {
+		t.Fatalf("%d entries, want %d", len(f.Entries), len(want))
+	}
+	for i, tt := range want {
+		if en := f.Entries[i]; en.Title != tt.title || en.URL.String() != tt.url {
+			t.Errorf("entry %d is %q %s, want %q %s", i, en.Title, en.URL, tt.title, tt.url)
+		}
+	}
+}
@@ -6,7 +6,17 @@ import (
 	"strings"
 )
 
-// format the URL for Gemini scheme
+// default ports of the schemes which the client dials
+var defaultPorts = map[string]string{
+	"gemini":  "1965",
+	"spartan": spartanPort,
+	"gopher":  gopherPort,
+	"finger":  fingerPort,
+	"nex":     nexPort,
+}
+
+// format the URL for Gemini scheme (relative links of a Spartan,
+// Gopher or Nex page keep the scheme of the page)
 func Format(raw string, referer string) (*url.URL, error) {
 	//TODO make unit tests to prove we follow
 	//     https://gemini.circumlunar.space/docs/specification.gmi
@@ -16,7 +26,7 @@ func Format(raw string, referer string) (*url.URL, error) {
 		tmp = raw
 		rfr = &url.URL{Scheme: "gemini", Host: ":1965"}
 	)
-	if strings.HasPrefix(referer, "gemini://") {
+	if scheme, _, ok := strings.Cut(referer, "://"); ok && defaultPorts[scheme] != "" {
 		if rfr, err = url.Parse(referer); err != nil {
 			return &url.URL{}, err
 		}
@@ -24,17 +34,22 @@ func Format(raw string, referer string) (*url.URL, error) {
 	// b) no scheme, no host, relative path (causes empty scheme/host result)
 	//    (are dot paths allowed in links?)
 	if strings.HasPrefix(raw, "/") {
-		tmp = fmt.Sprintf("gemini://%s%s", rfr.Host, raw)
+		tmp = fmt.Sprintf("%s://%s%s", rfr.Scheme, rfr.Host, raw)
 	} else if foundAt := strings.Index(raw, ":/"); foundAt == -1 {
 		// a) no scheme
 		dotAt := strings.Index(raw, ".")
 		slash := strings.HasSuffix(raw, "/")
 		if dotAt == -1 && slash {
 			// relative off-root
-			tmp = fmt.Sprintf("gemini://%s/%s", rfr.Host, raw)
+			tmp = fmt.Sprintf("%s://%s/%s", rfr.Scheme, rfr.Host, raw)
 		} else if dotAt != -1 && rfr.Hostname() != "" {
 			// assume explicit file and ext (index.gmi)
-			tmp = fmt.Sprintf("gemini://%s/%s/%s", rfr.Host, rfr.Path, raw)
+			// (without doubled slashes of the directory)
+			var dir = strings.Trim(rfr.Path, "/")
+			if dir != "" {
+				dir += "/"
+			}
+			tmp = fmt.Sprintf("%s://%s/%s%s", rfr.Scheme, rfr.Host, dir, raw)
 		}
 	}
 
@@ -49,9 +64,9 @@ func Format(raw string, referer string) (*url.URL, error) {
 			lu.Host = rfr.Host
 		}
 	}
-	if lu.Port() == "" && lu.Scheme == "gemini" {
+	if port, ok := defaultPorts[lu.Scheme]; ok && lu.Port() == "" {
 		// be unambiguous for port
-		lu.Host += ":1965"
+		lu.Host += ":" + port
 	}
 
 	return lu, nil
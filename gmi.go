@@ -3,9 +3,10 @@ package gmi
 import (
 	"bufio"
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/url"
 	"strconv"
 	"strings"
@@ -14,19 +15,24 @@ import (
 import "golang.org/x/sync/errgroup"
 
 type control struct {
-	conn  *tls.Conn
-	state Transition
-	rules safemap
-	g     *errgroup.Group
-	ctx   context.Context
+	conn   net.Conn
+	state  Transition
+	rules  safemap
+	g      *errgroup.Group
+	ctx    context.Context
+	base   *url.URL // page address after redirects
+	meta   string   // response header meta field
+	accept func(meta string) bool
+	hangup chan struct{} // ends the context watch of the connection
+	stop   bool          // redirects are returned instead of followed
+	hops   int           // redirects followed by the current Dial
 }
 type safemap struct {
 	sync.RWMutex
 	m map[LineType]*rewriter
 }
 type rewriter struct {
-	fn func(Node) string
-	ch chan Node
+	fn func(context.Context, Node) (string, error)
 }
 
 func NewControl(ctx context.Context) *control {
@@ -36,25 +42,75 @@ func NewControl(ctx context.Context) *control {
 	}
 
 	ctrl.Attach(PlainLine, vanilla)
-	ctrl.Attach(LinkLine, rewriteLink)
+	ctrl.AttachContext(LinkLine, rewriteLink)
+	ctrl.AttachContext(PromptLine, rewritePrompt)
 	return ctrl
 }
 
 func (c *control) Dial(u *url.URL, cfg Params) (*bufio.Reader, error) {
-	var (
-		err            error
-		status         int
-		responseHeader string
-	)
+	c.hops = 0
+	return c.dial(u, cfg)
+}
+
+func (c *control) dial(u *url.URL, cfg Params) (*bufio.Reader, error) {
+	switch u.Scheme {
+	case "spartan":
+		return c.spartan(u, cfg)
+	case "gopher":
+		return c.gopher(u)
+	case "finger":
+		return c.finger(u)
+	case "nex":
+		return c.nex(u)
+	}
+	if err := c.connect(u, cfg); err != nil {
+		return nil, err
+	}
+	// Send request (CR LF terminated)
+	c.conn.Write([]byte(u.String() + "\r\n"))
+	return c.response(u, cfg)
+}
+
+// open the TLS connection to the capsule of the URL
+func (c *control) connect(u *url.URL, cfg Params) error {
+	var err error
 	// encapsulate the key name from caller
 	cx := context.WithValue(c.ctx, maskISVKey, cfg)
 	if c.conn, err = dialTLS(cx, u); err != nil {
-		return nil, fmt.Errorf("Failed to connect: %w", err)
+		return fmt.Errorf("Failed to connect: %w", err)
 	}
+	c.bind()
+	return nil
+}
+
+// the deadline of the context bounds the reads and writes, the cancel
+// of the context closes the connection
+func (c *control) bind() {
 	c.state = NetOpen
-	// Send request (CR LF terminated)
-	c.conn.Write([]byte(u.String() + "\r\n"))
+	if dl, ok := c.ctx.Deadline(); ok {
+		c.conn.SetDeadline(dl)
+	}
+	if c.ctx.Done() == nil {
+		return
+	}
+	var conn, hangup = c.conn, make(chan struct{})
+	c.hangup = hangup
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			conn.Close()
+		case <-hangup:
+		}
+	}()
+}
 
+// read the response header, the reader is positioned at the body
+func (c *control) response(u *url.URL, cfg Params) (*bufio.Reader, error) {
+	var (
+		err            error
+		status         int
+		responseHeader string
+	)
 	// Receive and parse response header
 	reader := bufio.NewReader(c.conn)
 	if responseHeader, err = reader.ReadString('\n'); err != nil {
@@ -62,48 +118,115 @@ func (c *control) Dial(u *url.URL, cfg Params) (*bufio.Reader, error) {
 	}
 	// split on whitespace
 	parts := strings.Fields(responseHeader)
-	// status is two digits (but we only care about the leading digit)
-	if status, err = strconv.Atoi(parts[0][0:1]); err != nil {
+	if len(parts) == 0 || len(parts[0]) != 2 {
+		return c.dialError("Failed to extract status")
+	}
+	// status is two digits (but we mostly care about the leading digit)
+	if status, err = strconv.Atoi(parts[0]); err != nil {
 		return c.dialError("Failed to extract status %w", err)
 	}
 
-	switch status {
-	case 1, 6:
-		// No input, or client certs
-		return c.dialError("Unsupported feature! - " + strconv.Itoa(status))
+	switch status / 10 {
+	case 1, 4, 5, 6:
+		// input, failures and client certs are left to the caller
+		c.preRedirect()
+		return nil, &StatusError{Status: status, Meta: metaHeader(responseHeader, parts[0])}
 
 	case 2: // success
-		// text/* content only
-		meta := metaHeader(parts)
-		if !strings.HasPrefix(meta, "text/") {
+		// text/* content and feeds only (unless Accept says otherwise)
+		meta := metaHeader(responseHeader, parts[0])
+		if !c.accepts(meta) {
 			return c.dialError("Not-implemented MIME support, " + meta)
 		}
+		c.base, c.meta = u, meta
 		return reader, nil
 
 	case 3: // redirect
-		// TODO ctx.Value(TLSRedirect) != 0
-		meta := metaHeader(parts)
+		meta := metaHeader(responseHeader, parts[0])
 		if meta == "" {
 			return c.dialError("REDIR meta header field error")
 		}
 		if lu, err := Format(meta, u.String()); err == nil {
-			c.preRedirect()
-			return c.Dial(lu, cfg)
+			return c.redirect(status, lu, cfg)
 		}
 		return c.dialError("REDIR " + meta)
-	case 4, 5:
-		return c.dialError("ERROR: gemini status code 4 or 5")
 	}
 
 	return c.dialError("Exceptional status code did not match known values.")
 }
-func metaHeader(parts []string) string {
-	if len(parts) < 2 {
-		// missing meta field in the header
-		////return c.dialError("Response header meta field")
-		return ""
+
+// clients should not follow more than 5 redirects in a row
+const maxRedirects = 5
+
+// follow the redirect, or return it when the caller asked to stop
+func (c *control) redirect(status int, lu *url.URL, cfg Params) (*bufio.Reader, error) {
+	c.preRedirect()
+	if c.stop {
+		return nil, &RedirectError{Status: status, URL: lu}
+	}
+	if c.hops++; c.hops > maxRedirects {
+		return nil, fmt.Errorf("REDIR limit of %d redirects exceeded, %s", maxRedirects, lu)
+	}
+	return c.dial(lu, cfg)
+}
+
+// RedirectError is the redirect (3x) which was not followed, see
+// StopRedirect
+type RedirectError struct {
+	Status int // two digits (spartan redirects are 30)
+	URL    *url.URL
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("Gemini redirect %d, %s", e.Status, e.URL)
+}
+
+// StopRedirect returns the redirects as RedirectError to the caller
+// instead of following them, e.g. a proxy which checks the target
+// before it connects
+func (c *control) StopRedirect() {
+	c.stop = true
+}
+
+// StatusError is the response which is neither success nor redirect,
+// the meta is the prompt (1x), the failure message (4x, 5x) or the
+// certificate request (6x)
+type StatusError struct {
+	Status int // two digits
+	Meta   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Gemini status %d, %s", e.Status, e.Meta)
+}
+
+// Accept replaces the MIME filter of the success response (text and
+// feeds by default), e.g. a proxy which passes any body through
+func (c *control) Accept(f func(meta string) bool) {
+	c.accept = f
+}
+
+// body of the MIME type is read (the Accept filter or text)
+func (c *control) accepts(meta string) bool {
+	if c.accept != nil {
+		return c.accept(meta)
+	}
+	return textual(meta)
+}
+
+// MIME types which are read as text (feeds are XML)
+func textual(meta string) bool {
+	if strings.HasPrefix(meta, "text/") {
+		return true
 	}
-	meta := parts[1]
+	var mt = strings.SplitN(meta, ";", 2)[0]
+	return mt == "application/atom+xml" || mt == "application/xml"
+}
+
+// the rest of the header line after the status (prompts and
+// MIME parameters have spaces)
+func metaHeader(header string, status string) string {
+	meta := strings.TrimSpace(strings.TrimPrefix(header, status))
 	if len(meta) > 1024 {
 		// cannot exceed 1024 bytes
 		////return c.dialError("Response header size of meta field")
@@ -122,6 +245,7 @@ const (
 	ListLine
 	BlockLine
 	PrefmtLine
+	PromptLine
 )
 
 func (l LineType) String() string {
@@ -138,11 +262,20 @@ func (l LineType) String() string {
 		return ">"
 	case PrefmtLine:
 		return "```"
+	case PromptLine:
+		return "=:"
 	}
 	return ""
 }
 
-func (c *control) Attach(lt LineType, f func(Node) string) error {
+// Attach adapts the rule which ignores the context
+func (c *control) Attach(lt LineType, f func(Node) (string, error)) error {
+	return c.AttachContext(lt, adapt(f))
+}
+
+// AttachContext registers the rule which receives the page scope
+// (see BaseURL, Meta and NodeIndex)
+func (c *control) AttachContext(lt LineType, f func(context.Context, Node) (string, error)) error {
 	c.rules.Lock()
 	defer c.rules.Unlock()
 	/*
@@ -151,21 +284,16 @@ func (c *control) Attach(lt LineType, f func(Node) string) error {
 			return fmt.Errorf("Rewriter already attached for %v", op)
 		}*/
 
-	var ch = make(chan Node)
-	c.rules.m[lt] = &rewriter{fn: f, ch: ch}
+	c.rules.m[lt] = &rewriter{fn: f}
 
 	return nil
 }
 
 func (c *control) Retrieve(r *bufio.Reader) (string, error) {
-	c.rules.Lock()
-	defer c.rules.Unlock()
 	var (
-		bld  strings.Builder
 		buf  []byte
 		err  error
 		tree *Tree
-		acc  = make(chan string)
 	)
 	// grab the entire gemini body since Parse() accepts the body as string
 	if buf, err = ioutil.ReadAll(r); err != nil {
@@ -175,63 +303,130 @@ func (c *control) Retrieve(r *bufio.Reader) (string, error) {
 		return "", err
 	}
 
-	//TODO support cancellable
-	grp, _ := errgroup.WithContext(c.ctx)
-	go func() {
-		// accumulate results
-		for row := range acc {
-			bld.WriteString(row)
-		}
-	}()
+	var (
+		rules = c.snapshot()
+		// each worker owns the row at its node index (no shared writes)
+		rows     = make([]string, len(tree.Root.Nodes))
+		errs     = make([]error, len(tree.Root.Nodes))
+		pools    = make(map[LineType]chan job, len(rules))
+		grp, ctx = errgroup.WithContext(c.ctx)
+	)
+	// rules can reach the page details through the context
+	ctx = context.WithValue(ctx, pageScopeKey, pageScope{base: c.base, meta: c.meta})
+	for lt, run := range rules {
+		ch := make(chan job)
+		pools[lt] = ch
+		spawn(grp, poolSize, ch, run.fn, rows, errs)
+	}
 	// tree walk
-	for _, no := range tree.Root.Nodes {
-		switch no.Type() {
-		case NodeLink:
-			if run, ok := c.rules.m[LinkLine]; ok {
-				spawn(run.ch, run.fn, acc, grp)
-				run.ch <- no
-			}
-		default:
-			if run, ok := c.rules.m[PlainLine]; ok {
-				spawn(run.ch, run.fn, acc, grp)
-				run.ch <- no
-			}
+walk:
+	for i, no := range tree.Root.Nodes {
+		lt := lineType(no)
+		ch, ok := pools[lt]
+		if !ok && lt != LinkLine {
+			// catchall rule for line types without their own
+			ch, ok = pools[PlainLine]
+		}
+		if !ok {
+			continue
 		}
+		select {
+		case ch <- job{ctx: context.WithValue(ctx, nodeIndexKey, i), index: i, node: no}:
+		case <-ctx.Done():
+			// a rewriter failed or the caller cancelled
+			break walk
+		}
+	}
+	// signal the workers to end
+	for _, ch := range pools {
+		close(ch)
+	}
+	if err = grp.Wait(); err != nil {
+		return "", err
+	}
+	if err = c.ctx.Err(); err != nil {
+		return "", err
+	}
+	// keep the rows that did succeed along with the failures
+	var failed RewriteErrors
+	for _, e := range errs {
+		if e != nil {
+			failed = append(failed, e)
+		}
+	}
+	if len(failed) != 0 {
+		return strings.Join(rows, ""), failed
 	}
 
-	// wait for grs to complete
-	grp.Wait()
-	// signal the for/range to end
-	close(acc)
+	return strings.Join(rows, ""), nil
+}
 
-	return bld.String(), nil
+// URL is the page address after redirects (nil until Dial succeeds)
+func (c *control) URL() *url.URL {
+	return c.base
 }
 
-// Disconnect and close gr channels
-func (c *control) Close() {
-	c.rules.Lock()
-	defer c.rules.Unlock()
+// Meta is the MIME type from the response header
+func (c *control) Meta() string {
+	return c.meta
+}
 
-	if c.state != NetClose {
-		//todo atomic set
-		c.state = NetClose
-		c.conn.Close()
+// copy of the rules, so Attach is not blocked during the tree walk
+func (c *control) snapshot() map[LineType]*rewriter {
+	c.rules.RLock()
+	defer c.rules.RUnlock()
+	var cp = make(map[LineType]*rewriter, len(c.rules.m))
+	for lt, run := range c.rules.m {
+		cp[lt] = run
 	}
-	for _, run := range c.rules.m {
-		close(run.ch)
+	return cp
+}
+
+// which rule applies to the node
+func lineType(n Node) LineType {
+	switch n.Type() {
+	case NodeLink:
+		return LinkLine
+	case NodeHeading:
+		return HeadingLine
+	case NodeItem:
+		return ListLine
+	case NodeQuote:
+		return BlockLine
+	case NodePreformat:
+		return PrefmtLine
+	case NodePrompt:
+		return PromptLine
+	}
+	return PlainLine
+}
+
+// Disconnect from the capsule
+func (c *control) Close() {
+	if c.conn != nil && c.state != NetClose {
+		//todo atomic set
+		c.disconnect()
 	}
 }
 func (c *control) preRedirect() {
+	c.disconnect()
+}
+func (c *control) disconnect() {
 	c.state = NetClose
 	c.conn.Close()
+	if c.hangup != nil {
+		// release the watch of the context
+		close(c.hangup)
+		c.hangup = nil
+	}
 }
 func (c *control) dialError(ar string, e ...error) (*bufio.Reader, error) {
 	// convenience to close connection, from dial errors
 	c.preRedirect()
 	if len(e) > 0 {
-		return nil, fmt.Errorf(ar, e)
+		return nil, fmt.Errorf(ar, e[0])
 	}
-	return nil, fmt.Errorf(ar)
+	return nil, errors.New(ar)
 }
 
 type Params interface {
@@ -0,0 +1,120 @@
+package gmi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// page with every line type, enough lines to keep the workers busy
+func retrievePage(lines int) string {
+	var sb strings.Builder
+	sb.WriteString("# Title\n")
+	for i := 0; i < lines; i++ {
+		switch i % 5 {
+		case 0:
+			fmt.Fprintf(&sb, "=> /page%d.gmi Page %d\n", i, i)
+		case 1:
+			fmt.Fprintf(&sb, "* item %d\n", i)
+		case 2:
+			fmt.Fprintf(&sb, "> quote %d\n", i)
+		case 3:
+			fmt.Fprintf(&sb, "```alt %d\npre %d\n```\n", i, i)
+		default:
+			fmt.Fprintf(&sb, "text %d\n", i)
+		}
+	}
+	return sb.String()
+}
+
+// each node gets a random delay so the workers finish out of order
+func jitter(_ context.Context, n Node) (string, error) {
+	time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+	return fmt.Sprintf("\n%d %s", n.Position(), n.String()), nil
+}
+
+func retrieveWith(ctx context.Context, page string, f func(context.Context, Node) (string, error)) (string, error) {
+	var ctrl = NewControl(ctx)
+	ctrl.AttachContext(PlainLine, f)
+	ctrl.AttachContext(LinkLine, f)
+	return ctrl.Retrieve(bufio.NewReader(strings.NewReader(page)))
+}
+
+func TestRetrieveOrder(t *testing.T) {
+	var page = retrievePage(200)
+	tree, err := Parse(page)
+	if err != nil {
+		t.Fatalf("Parse, %v", err)
+	}
+	var want strings.Builder
+	for _, n := range tree.Root.Nodes {
+		fmt.Fprintf(&want, "\n%d %s", n.Position(), n.String())
+	}
+	// concurrent controls do not share the rows
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := retrieveWith(context.Background(), page, jitter)
+			if err != nil {
+				t.Errorf("Retrieve, %v", err)
+				return
+			}
+			if got != want.String() {
+				t.Errorf("Retrieve order differs\ngot  %q\nwant %q", got, want.String())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRetrieveErrors(t *testing.T) {
+	var page = "one\ntwo\nthree\nfour\n"
+	got, err := retrieveWith(context.Background(), page, func(ctx context.Context, n Node) (string, error) {
+		if strings.HasPrefix(n.String(), "t") {
+			return "", fmt.Errorf("refused %s", n.String())
+		}
+		return "\n" + n.String(), nil
+	})
+	var failed RewriteErrors
+	if !errors.As(err, &failed) {
+		t.Fatalf("Retrieve error %v, want RewriteErrors", err)
+	}
+	if len(failed) != 2 {
+		t.Errorf("Retrieve failures %d, want 2 (%v)", len(failed), failed)
+	}
+	// the rows which succeeded are kept in order
+	if got != "\none\nfour" {
+		t.Errorf("Retrieve rows %q, want %q", got, "\none\nfour")
+	}
+}
+
+func TestRetrieveCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := retrieveWith(ctx, retrievePage(50), jitter)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Retrieve error %v, want context.Canceled", err)
+	}
+}
+
+func TestRetrieveCancelDuring(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var once sync.Once
+	_, err := retrieveWith(ctx, retrievePage(200), func(c context.Context, n Node) (string, error) {
+		// the first rule call cancels the rest of the walk
+		once.Do(cancel)
+		return jitter(c, n)
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Retrieve error %v, want context.Canceled", err)
+	}
+}
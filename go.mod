@@ -1,13 +1,15 @@
 module github.com/shrmpy/gmi
 
-go 1.18
+go 1.24.0
 
 require (
 	github.com/gdamore/tcell/v2 v2.5.1
 	github.com/hajimehoshi/ebiten/v2 v2.3.3
+	github.com/mattn/go-runewidth v0.0.13
 	github.com/tinne26/etxt v0.0.1
-	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
-	golang.org/x/sync v0.0.0-20220601150217-0de741cfad7f
+	golang.org/x/crypto v0.42.0
+	golang.org/x/net v0.45.0
+	golang.org/x/sync v0.17.0
 )
 
 require (
@@ -16,12 +18,11 @@ require (
 	github.com/gofrs/flock v0.8.1 // indirect
 	github.com/jezek/xgb v1.0.0 // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
-	github.com/mattn/go-runewidth v0.0.13 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
 	golang.org/x/exp v0.0.0-20190731235908-ec7cb31e5a56 // indirect
 	golang.org/x/image v0.0.0-20220321031419-a8550c1d254a // indirect
 	golang.org/x/mobile v0.0.0-20220518205345-8578da9835fd // indirect
-	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
-	golang.org/x/term v0.0.0-20201210144234-2321bbc49cbf // indirect
-	golang.org/x/text v0.3.7 // indirect
+	golang.org/x/sys v0.36.0 // indirect
+	golang.org/x/term v0.35.0 // indirect
+	golang.org/x/text v0.29.0 // indirect
 )
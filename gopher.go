@@ -0,0 +1,181 @@
+package gmi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Gopher menus and text files are converted to gemtext, so the rules
+// of the readers apply to gopher holes too
+const gopherPort = "70"
+
+// item type and selector of the gopher URL (gopher://host/1/phlog),
+// the search text of type 7 is the query or follows a tab
+func gopherSelector(u *url.URL) (byte, string, string, error) {
+	var (
+		kind     = byte('1')
+		selector = strings.TrimPrefix(u.Path, "/")
+	)
+	if selector != "" {
+		kind, selector = selector[0], selector[1:]
+	}
+	selector, search, _ := strings.Cut(selector, "\t")
+	if u.RawQuery != "" {
+		var err error
+		if search, err = url.PathUnescape(u.RawQuery); err != nil {
+			return 0, "", "", fmt.Errorf("Gopher search malformed, %w", err)
+		}
+	}
+	return kind, selector, search, nil
+}
+
+// send the selector over plain TCP, menus (1 and 7) become links and
+// text files (0 and h) become a preformat block, binary files (9, I
+// and g) pass through when the MIME type is accepted
+func (c *control) gopher(u *url.URL) (*bufio.Reader, error) {
+	kind, selector, search, err := gopherSelector(u)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case '0', '1', 'h':
+	case '9', 'I', 'g':
+		var meta = gopherMime(kind, selector)
+		if !c.accepts(meta) {
+			return nil, fmt.Errorf("Not-implemented MIME support, %s", meta)
+		}
+		buf, err := c.exchange(u, gopherPort, selector)
+		if err != nil {
+			return nil, err
+		}
+		c.base, c.meta = u, meta
+		return bufio.NewReader(bytes.NewReader(buf)), nil
+	case '7':
+		if search == "" {
+			// the reader asks for the text with the input line
+			doc := NewDocument().Prompt(u.String(), "Search "+selector)
+			return c.gemtext(u, doc.tree)
+		}
+		selector += "\t" + search
+	default:
+		return nil, fmt.Errorf("Not-implemented gopher item type, %c", kind)
+	}
+	buf, err := c.exchange(u, gopherPort, selector)
+	if err != nil {
+		return nil, err
+	}
+	if kind == '0' || kind == 'h' {
+		var doc = NewDocument().Pre(path.Base(selector), gopherText(buf))
+		return c.gemtext(u, doc.tree)
+	}
+	tree, err := Gophermap(bytes.NewReader(buf))
+	if err != nil {
+		return c.dialError("Gophermap failed, %w", err)
+	}
+	return c.gemtext(u, tree)
+}
+
+// gopher items carry no MIME type, the extension of the selector
+// decides (gif for g)
+func gopherMime(kind byte, selector string) string {
+	if kind == 'g' {
+		return "image/gif"
+	}
+	if mt := mime.TypeByExtension(path.Ext(selector)); mt != "" {
+		return mt
+	}
+	if kind == 'I' {
+		return "image/jpeg"
+	}
+	return "application/octet-stream"
+}
+
+// the converted page is read like a gemini body
+func (c *control) gemtext(u *url.URL, tree *Tree) (*bufio.Reader, error) {
+	var buf bytes.Buffer
+	if _, err := tree.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	c.base, c.meta = u, "text/gemini"
+	return bufio.NewReader(&buf), nil
+}
+
+// Gophermap converts the menu into text and link lines, the search
+// items (type 7) are input lines
+func Gophermap(r io.Reader) (*Tree, error) {
+	var (
+		doc = NewDocument()
+		scn = bufio.NewScanner(r)
+	)
+	for scn.Scan() {
+		var row = strings.TrimRight(scn.Text(), "\r")
+		if row == "." {
+			break
+		}
+		if row == "" {
+			doc.Blank()
+			continue
+		}
+		var fields = strings.Split(row[1:], "\t")
+		if len(fields) < 4 {
+			// without the selector, host and port it is only text
+			doc.Text(strings.TrimRight(row[1:], "\t"))
+			continue
+		}
+		var (
+			kind    = row[0]
+			display = fields[0]
+			item    = &url.URL{
+				Scheme: "gopher",
+				Host:   net.JoinHostPort(fields[2], fields[3]),
+				Path:   "/" + string(kind) + fields[1],
+			}
+		)
+		switch kind {
+		case 'i', '3':
+			doc.Text(display)
+		case '0', '1', '9', 'I', 'g':
+			doc.Link(item.String(), display)
+		case '7':
+			doc.Prompt(item.String(), display)
+		case 'h':
+			if strings.HasPrefix(fields[1], "URL:") {
+				// hyperlink to another protocol
+				if lu, err := url.Parse(strings.TrimPrefix(fields[1], "URL:")); err == nil {
+					doc.Link(lu.String(), display)
+					continue
+				}
+			}
+			doc.Link(item.String(), display)
+		default:
+			doc.Text(display)
+		}
+	}
+	if err := scn.Err(); err != nil {
+		return nil, err
+	}
+	return doc.Tree()
+}
+
+// lines of the text file without the terminator (lone period)
+// and the doubled leading period
+func gopherText(buf []byte) string {
+	var rows = strings.Split(plainText(buf), "\n")
+	for i, row := range rows {
+		if row == "." {
+			rows = rows[:i]
+			break
+		}
+		if strings.HasPrefix(row, "..") {
+			rows[i] = row[1:]
+		}
+	}
+	return strings.Join(rows, "\n")
+}
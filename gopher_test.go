@@ -0,0 +1,169 @@
+package gmi
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGophermap(t *testing.T) {
+	var tests = []struct {
+		name string
+		menu string
+		want string
+	}{
+		{"info", "iWelcome\tfake\t(NULL)\t0\r\n", "Welcome\n"},
+		{"text", "0About\t/about.txt\tgopher.example\t70\r\n", "=> gopher://gopher.example:70/0/about.txt About\n"},
+		{"menu", "1Phlog\t/phlog\tgopher.example\t7070\r\n", "=> gopher://gopher.example:7070/1/phlog Phlog\n"},
+		{"binary", "9Archive\t/a.zip\tg.example\t70\r\nIPhoto\t/p.jpg\tg.example\t70\r\n", "=> gopher://g.example:70/9/a.zip Archive\n=> gopher://g.example:70/I/p.jpg Photo\n"},
+		{"search", "7Search\t/search\tgopher.example\t70\r\n", "=: gopher://gopher.example:70/7/search Search\n"},
+		{"hyperlink", "hWeb\tURL:https://example.org/\tgopher.example\t70\r\n", "=> https://example.org/ Web\n"},
+		{"html file", "hPage\t/p.html\tgopher.example\t70\r\n", "=> gopher://gopher.example:70/h/p.html Page\n"},
+		{"error", "3Not found\t\terror.host\t1\r\n", "Not found\n"},
+		{"unknown type", "8Telnet\t\thost\t23\r\n", "Telnet\n"},
+		{"short row", "iplain text\t\r\n", "plain text\n"},
+		{"blank", "iA\tf\th\t0\n\niB\tf\th\t0\n", "A\n\nB\n"},
+		{"terminator", "iA\tf\th\t0\r\n.\r\niafter\tf\th\t0\r\n", "A\n"},
+	}
+	for _, tt := range tests {
+		tree, err := Gophermap(strings.NewReader(tt.menu))
+		if err != nil {
+			t.Errorf("%s: Gophermap, %v", tt.name, err)
+			continue
+		}
+		var sb strings.Builder
+		tree.WriteTo(&sb)
+		if sb.String() != tt.want {
+			t.Errorf("%s: gemtext %q, want %q", tt.name, sb.String(), tt.want)
+		}
+	}
+}
+
+func TestGopherText(t *testing.T) {
+	var tests = []struct {
+		text string
+		want string
+	}{
+		{"one\r\ntwo\r\n", "one\ntwo\n"},
+		{"one\r\n.\r\nafter\r\n", "one"},
+		{"..dotted\r\n.\r\n", ".dotted"},
+		{"no terminator", "no terminator"},
+	}
+	for _, tt := range tests {
+		if got := gopherText([]byte(tt.text)); got != tt.want {
+			t.Errorf("%q: text %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestGopherSelector(t *testing.T) {
+	var tests = []struct {
+		addr     string
+		kind     byte
+		selector string
+		search   string
+		ok       bool
+	}{
+		{"gopher://g.example", '1', "", "", true},
+		{"gopher://g.example/", '1', "", "", true},
+		{"gopher://g.example/1/phlog", '1', "/phlog", "", true},
+		{"gopher://g.example/0/about%20me.txt", '0', "/about me.txt", "", true},
+		{"gopher://g.example/7/search%09cats", '7', "/search", "cats", true},
+		{"gopher://g.example/7/search?black%20cats", '7', "/search", "black cats", true},
+		{"gopher://g.example/7/search?%zz", 0, "", "", false},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.addr)
+		kind, selector, search, err := gopherSelector(u)
+		if ok := err == nil; ok != tt.ok || kind != tt.kind || selector != tt.selector || search != tt.search {
+			t.Errorf("%s: selector %c %q %q (error %v), want %c %q %q", tt.addr, kind, selector, search, err, tt.kind, tt.selector, tt.search)
+		}
+	}
+}
+
+func TestGopherMime(t *testing.T) {
+	var tests = []struct {
+		kind     byte
+		selector string
+		want     string
+	}{
+		{'g', "/anim", "image/gif"},
+		{'I', "/photo.png", "image/png"},
+		{'I', "/photo", "image/jpeg"},
+		{'9', "/a.zip", "application/zip"},
+		{'9', "/blob", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		if got := gopherMime(tt.kind, tt.selector); got != tt.want {
+			t.Errorf("%c%s: MIME %s, want %s", tt.kind, tt.selector, got, tt.want)
+		}
+	}
+}
+
+// selectors sent to the local gopher hole and the converted pages
+func TestGopher(t *testing.T) {
+	var hole = servePlain(t, func(r *bufio.Reader) (string, string) {
+		line, _ := r.ReadString('\n')
+		var pages = map[string]string{
+			"":              "iWelcome\tfake\t(NULL)\t0\r\n1Phlog\t/phlog\tlocalhost\t70\r\n.\r\n",
+			"/about.txt":    "About\r\n..dotted\r\n.\r\n",
+			"/search\tcats": "0Cats\t/cats.txt\tlocalhost\t70\r\n.\r\n",
+			"/p.gif":        "GIF89a",
+		}
+		return line, pages[strings.TrimRight(line, "\r\n")]
+	})
+	var tests = []struct {
+		name string
+		path string
+		meta string
+		body string
+		req  string // "" when nothing is sent
+		err  string
+	}{
+		{"root menu", "", "text/gemini", "Welcome\n=> gopher://localhost:70/1/phlog Phlog\n", "\r\n", ""},
+		{"text file", "/0/about.txt", "text/gemini", "```about.txt\nAbout\n.dotted\n```\n", "/about.txt\r\n", ""},
+		{"search prompt", "/7/search", "text/gemini", "=: gopher://" + hole.addr + "/7/search Search /search\n", "", ""},
+		{"search", "/7/search?cats", "text/gemini", "=> gopher://localhost:70/0/cats.txt Cats\n", "/search\tcats\r\n", ""},
+		{"image", "/g/p.gif", "", "", "", "Not-implemented MIME support, image/gif"},
+		{"telnet", "/8/host", "", "", "", "Not-implemented gopher item type, 8"},
+	}
+	for _, tt := range tests {
+		var before = len(hole.requests())
+		u, _ := url.Parse("gopher://" + hole.addr + tt.path)
+		var ctrl = NewControl(context.Background())
+		rdr, err := ctrl.Dial(u, nil)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: Dial error %v, want %s", tt.name, err, tt.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: Dial, %v", tt.name, err)
+		} else {
+			body, _ := io.ReadAll(rdr)
+			if ctrl.Meta() != tt.meta || string(body) != tt.body {
+				t.Errorf("%s: response %q %q, want %q %q", tt.name, ctrl.Meta(), body, tt.meta, tt.body)
+			}
+		}
+		ctrl.Close()
+		var reqs = hole.requests()[before:]
+		if (tt.req == "") != (len(reqs) == 0) || (len(reqs) > 0 && reqs[0] != tt.req) {
+			t.Errorf("%s: requests %q, want %q", tt.name, reqs, tt.req)
+		}
+	}
+
+	// the filter passes the image through
+	u, _ := url.Parse("gopher://" + hole.addr + "/g/p.gif")
+	var ctrl = NewControl(context.Background())
+	ctrl.Accept(func(string) bool { return true })
+	defer ctrl.Close()
+	rdr, err := ctrl.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("Dial with the filter, %v", err)
+	}
+	if body, _ := io.ReadAll(rdr); ctrl.Meta() != "image/gif" || string(body) != "GIF89a" {
+		t.Errorf("image response %q %q", ctrl.Meta(), body)
+	}
+}
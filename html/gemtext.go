@@ -0,0 +1,372 @@
+package html
+
+import (
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/shrmpy/gmi"
+	"github.com/shrmpy/gmi/internal/gemtext"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Parse converts the HTML document into a Gemtext tree; headings map
+// to levels 1-3, paragraphs become single lines, links move to link
+// lines (absolute against base) after their block, pre is preserved,
+// tables become preformat blocks and scripts/styles are dropped.
+func Parse(r io.Reader, base *url.URL) (*gmi.Tree, error) {
+	root, err := xhtml.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	var c = &htmlConverter{Writer: gemtext.NewWriter(), base: base}
+	if href := findAttr(root, atom.Base, "href"); href != "" {
+		c.base = c.resolve(href)
+	}
+	if title := textOf(find(root, atom.Title)); title != "" && find(root, atom.H1) == nil {
+		// the page title stands in for the missing top heading
+		c.Block()
+		c.Doc.Heading(1, title)
+	}
+	if body := find(root, atom.Body); body != nil {
+		c.walk(body)
+	} else {
+		c.walk(root)
+	}
+	c.flush()
+	c.WriteLinks()
+	return c.Doc.Tree()
+}
+
+type htmlConverter struct {
+	*gemtext.Writer
+	base  *url.URL
+	text  strings.Builder // inline text of the open block
+	quote int             // depth of blockquote
+	items int             // depth of li
+	lists int             // depth of ul/ol
+	table bool            // the cells of a table are read
+}
+
+// elements which are dropped with their content
+var skipped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Template: true, atom.Head: true, atom.Svg: true,
+	atom.Iframe: true, atom.Object: true, atom.Button: true,
+	atom.Select: true, atom.Textarea: true, atom.Form: true,
+}
+
+// elements which start and end a line of the gemtext
+var blocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+	atom.Header: true, atom.Footer: true, atom.Main: true, atom.Nav: true,
+	atom.Aside: true, atom.Figure: true, atom.Figcaption: true,
+	atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Address: true,
+	atom.Details: true, atom.Summary: true, atom.Caption: true,
+}
+
+// elements which are kept apart from their neighbors in a cell
+var inCell = map[atom.Atom]bool{
+	atom.Table: true, atom.Tr: true, atom.Td: true, atom.Th: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Blockquote: true,
+	atom.Pre: true, atom.H1: true, atom.H2: true, atom.H3: true,
+	atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+func (c *htmlConverter) walk(n *xhtml.Node) {
+	switch n.Type {
+	case xhtml.TextNode:
+		c.text.WriteString(n.Data)
+		return
+	case xhtml.ElementNode:
+	case xhtml.DocumentNode:
+		c.children(n)
+		return
+	default:
+		// comments and doctype
+		return
+	}
+	if skipped[n.DataAtom] {
+		return
+	}
+	if c.table && n.DataAtom != atom.A && n.DataAtom != atom.Img && n.DataAtom != atom.Br {
+		// the cell is one line of the table (nested tables too)
+		var spaced = blocks[n.DataAtom] || inCell[n.DataAtom]
+		if spaced {
+			c.text.WriteString(" ")
+		}
+		c.children(n)
+		if spaced {
+			c.text.WriteString(" ")
+		}
+		return
+	}
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		c.flush()
+		c.children(n)
+		level, _ := strconv.Atoi(n.Data[1:])
+		c.heading(level)
+
+	case atom.Pre:
+		c.flush()
+		c.Block()
+		c.Doc.Pre(attr(n, "title"), strings.Trim(rawText(n), "\n"))
+		c.collect(n)
+		c.WriteLinks()
+
+	case atom.A:
+		var before = c.text.Len()
+		c.children(n)
+		name := collapse(c.text.String()[before:])
+		if href := attr(n, "href"); href != "" && !strings.HasPrefix(href, "#") {
+			c.addLink(href, name)
+		}
+
+	case atom.Img:
+		// images become links named by the alt text
+		if src := attr(n, "src"); src != "" {
+			c.addLink(src, attr(n, "alt"))
+		}
+
+	case atom.Br:
+		// paragraphs are reflowed as single lines
+		c.text.WriteString(" ")
+
+	case atom.Hr:
+		c.flush()
+
+	case atom.Ul, atom.Ol:
+		c.flush()
+		if c.lists == 0 && c.items == 0 {
+			c.Block()
+		}
+		c.lists++
+		c.children(n)
+		c.flush()
+		if c.lists--; c.lists == 0 {
+			c.WriteLinks()
+		}
+
+	case atom.Li:
+		c.flush()
+		c.items++
+		c.children(n)
+		c.flush()
+		c.items--
+
+	case atom.Blockquote:
+		c.flush()
+		if c.quote == 0 {
+			c.Block()
+		}
+		c.quote++
+		c.children(n)
+		c.flush()
+		if c.quote--; c.quote == 0 {
+			c.WriteLinks()
+		}
+
+	case atom.Table:
+		c.flush()
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			if ch.DataAtom == atom.Caption {
+				c.walk(ch)
+			}
+		}
+		c.table = true
+		var rows [][]string
+		for _, tr := range tableRows(n) {
+			var cells []string
+			var header = true
+			for td := tr.FirstChild; td != nil; td = td.NextSibling {
+				if td.DataAtom != atom.Td && td.DataAtom != atom.Th {
+					continue
+				}
+				header = header && td.DataAtom == atom.Th
+				c.children(td)
+				cells = append(cells, collapse(c.text.String()))
+				c.text.Reset()
+			}
+			if len(cells) == 0 {
+				continue
+			}
+			rows = append(rows, cells)
+			if len(rows) == 1 && header {
+				rows = append(rows, nil)
+			}
+		}
+		c.table = false
+		if len(rows) > 0 {
+			c.Table(rows)
+		}
+		c.WriteLinks()
+
+	default:
+		if blocks[n.DataAtom] {
+			c.flush()
+			c.children(n)
+			c.flush()
+			return
+		}
+		c.children(n)
+	}
+}
+
+func (c *htmlConverter) children(n *xhtml.Node) {
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		c.walk(ch)
+	}
+}
+
+// write the open block text as one line
+func (c *htmlConverter) flush() {
+	var text = collapse(c.text.String())
+	c.text.Reset()
+	if text == "" {
+		return
+	}
+	switch {
+	case c.items > 0:
+		if c.lists > 0 {
+			c.Doc.List(text)
+			return
+		}
+		c.Block()
+		c.Doc.List(text)
+	case c.quote > 0:
+		c.Doc.Quote(text)
+	default:
+		c.Block()
+		c.Doc.Text(text)
+	}
+	if c.lists == 0 && c.quote == 0 {
+		c.WriteLinks()
+	}
+}
+
+func (c *htmlConverter) heading(level int) {
+	var text = collapse(c.text.String())
+	c.text.Reset()
+	if level > 3 {
+		level = 3
+	}
+	if text != "" {
+		c.Block()
+		c.Doc.Heading(level, text)
+	}
+	c.WriteLinks()
+}
+
+func (c *htmlConverter) addLink(href string, name string) {
+	var lu = c.resolve(href)
+	if lu == nil {
+		return
+	}
+	switch strings.ToLower(lu.Scheme) {
+	case "javascript", "data", "vbscript":
+		return
+	}
+	c.AddLinks(gemtext.Link{URL: lu.String(), Name: name})
+}
+
+// links inside the preformat block
+func (c *htmlConverter) collect(n *xhtml.Node) {
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if ch.Type == xhtml.ElementNode && ch.DataAtom == atom.A {
+			if href := attr(ch, "href"); href != "" && !strings.HasPrefix(href, "#") {
+				c.addLink(href, collapse(textOf(ch)))
+			}
+		}
+		c.collect(ch)
+	}
+}
+
+// rows of the table, also inside thead, tbody and tfoot
+func tableRows(table *xhtml.Node) []*xhtml.Node {
+	var rows []*xhtml.Node
+	for ch := table.FirstChild; ch != nil; ch = ch.NextSibling {
+		switch ch.DataAtom {
+		case atom.Tr:
+			rows = append(rows, ch)
+		case atom.Thead, atom.Tbody, atom.Tfoot:
+			rows = append(rows, tableRows(ch)...)
+		}
+	}
+	return rows
+}
+
+// absolute URL against the base (nil when malformed)
+func (c *htmlConverter) resolve(href string) *url.URL {
+	lu, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return nil
+	}
+	if c.base != nil {
+		return c.base.ResolveReference(lu)
+	}
+	return lu
+}
+
+// whitespace runs become a single space
+func collapse(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func attr(n *xhtml.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// first element of the type in document order
+func find(n *xhtml.Node, a atom.Atom) *xhtml.Node {
+	if n.Type == xhtml.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if found := find(ch, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func findAttr(n *xhtml.Node, a atom.Atom, key string) string {
+	if el := find(n, a); el != nil {
+		return attr(el, key)
+	}
+	return ""
+}
+
+// collapsed text content of the element
+func textOf(n *xhtml.Node) string {
+	if n == nil {
+		return ""
+	}
+	return collapse(rawText(n))
+}
+
+// text content of the element with its whitespace
+func rawText(n *xhtml.Node) string {
+	var sb strings.Builder
+	var visit func(*xhtml.Node)
+	visit = func(n *xhtml.Node) {
+		if n.Type == xhtml.TextNode {
+			sb.WriteString(n.Data)
+		}
+		if n.Type == xhtml.ElementNode && n.DataAtom == atom.Br {
+			sb.WriteString("\n")
+		}
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			visit(ch)
+		}
+	}
+	visit(n)
+	return sb.String()
+}
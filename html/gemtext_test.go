@@ -0,0 +1,106 @@
+package html
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	var base, _ = url.Parse("https://example.org/dir/page.html")
+	var tests = []struct {
+		name string
+		html string
+		want string
+	}{
+		{"title", "<html><head><title>T</title></head><body><p>Hi</p></body></html>", "# T\n\nHi\n"},
+		{"title with h1", "<html><head><title>T</title></head><body><h1>Top</h1></body></html>", "# Top\n"},
+		{"headings", "<h1>One</h1><h2>Two</h2><h4>Four</h4><h6>Six</h6>", "# One\n\n## Two\n\n### Four\n\n### Six\n"},
+		{"reflow", "<p>one\n  two<br>three</p><div>four</div>", "one two three\n\nfour\n"},
+		{"entities", "<p>a &amp; b &lt;c&gt;</p>", "a & b <c>\n"},
+		{"dropped", "<p>kept</p><script>evil()</script><style>p{}</style><form><p>form</p></form>", "kept\n"},
+		{"quote", "<blockquote><p>q1</p><p>q2</p></blockquote>", "> q1\n> q2\n"},
+		{"pre", "<pre>  code\n  x</pre><p>after</p>", "```\n  code\n  x\n```\n\nafter\n"},
+		{"pre title", "<pre title=\"shell\">$ ls</pre>", "```shell\n$ ls\n```\n"},
+		{"hr", "<p>a<hr>b</p>", "a\n\nb\n"},
+	}
+	for _, tt := range tests {
+		if got := parse(t, tt.html, base); got != tt.want {
+			t.Errorf("%s: gemtext %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseLinks(t *testing.T) {
+	var base, _ = url.Parse("https://example.org/dir/page.html")
+	var tests = []struct {
+		name string
+		html string
+		want string
+	}{
+		{"after the paragraph", "<p>Hi <a href=\"/a\">A</a> and <a href=\"b.html\">B</a></p><p>next</p>", "Hi A and B\n=> https://example.org/a A\n=> https://example.org/dir/b.html B\n\nnext\n"},
+		{"absolute", "<p><a href=\"gemini://capsule.example/\">Capsule</a></p>", "Capsule\n=> gemini://capsule.example/ Capsule\n"},
+		{"base element", "<base href=\"https://other.example/\"><p><a href=\"rel\">R</a></p>", "R\n=> https://other.example/rel R\n"},
+		{"dropped", "<p><a href=\"javascript:x()\">J</a> <a href=\"#frag\">F</a> <a>none</a></p>", "J F none\n"},
+		{"image", "<p><img src=\"/i.png\" alt=\"Logo\"> text</p>", "text\n=> https://example.org/i.png Logo\n"},
+		{"heading", "<h2><a href=\"/s\">Section</a></h2>", "## Section\n=> https://example.org/s Section\n"},
+		{"in pre", "<pre>see <a href=\"/doc\">doc</a></pre>", "```\nsee doc\n```\n=> https://example.org/doc doc\n"},
+		{"in quote", "<blockquote><p><a href=\"/q\">Q</a></p><p>more</p></blockquote>", "> Q\n> more\n=> https://example.org/q Q\n"},
+	}
+	for _, tt := range tests {
+		if got := parse(t, tt.html, base); got != tt.want {
+			t.Errorf("%s: gemtext %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseLists(t *testing.T) {
+	var tests = []struct {
+		name string
+		html string
+		want string
+	}{
+		{"unordered", "<ul><li>one</li><li>two</li></ul>", "* one\n* two\n"},
+		{"ordered", "<ol><li>first</li><li>second</li></ol>", "* first\n* second\n"},
+		{"nested", "<ul><li>a<ul><li>nested</li></ul></li><li>b</li></ul>", "* a\n* nested\n* b\n"},
+		{"links after the list", "<ul><li>one <a href=\"/x\">X</a></li><li>two</li></ul><p>para</p>", "* one X\n* two\n=> /x X\n\npara\n"},
+		{"item outside a list", "<li>stray</li>", "* stray\n"},
+		{"two lists", "<ul><li>a</li></ul><ol><li>b</li></ol>", "* a\n\n* b\n"},
+	}
+	for _, tt := range tests {
+		if got := parse(t, tt.html, nil); got != tt.want {
+			t.Errorf("%s: gemtext %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTables(t *testing.T) {
+	var tests = []struct {
+		name string
+		html string
+		want string
+	}{
+		{"header", "<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>long cell</td></tr></table>", "```table\na | b\n- | ---------\n1 | long cell\n```\n"},
+		{"no header", "<table><tr><td>1</td><td>2</td></tr><tr><td>333</td><td>4</td></tr></table>", "```table\n1   | 2\n333 | 4\n```\n"},
+		{"sections", "<table><caption>Prices</caption><thead><tr><th>Item</th><th>€</th></tr></thead><tbody><tr><td>tea</td><td>1<br>2</td></tr><tr><td>only</td></tr></tbody></table>", "Prices\n\n```table\nItem | €\n---- | ---\ntea  | 1 2\nonly\n```\n"},
+		{"links after the table", "<table><tr><td><a href=\"/x\">X</a></td></tr></table><p>after</p>", "```table\nX\n```\n=> /x X\n\nafter\n"},
+		{"blocks in cells", "<table><tr><td><p>a</p><p>b</p></td><td>c<table><tr><td>inner</td></tr></table></td></tr></table>", "```table\na b | c inner\n```\n"},
+		{"empty", "<p>before</p><table></table><p>after</p>", "before\n\nafter\n"},
+	}
+	for _, tt := range tests {
+		if got := parse(t, tt.html, nil); got != tt.want {
+			t.Errorf("%s: gemtext %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func parse(t *testing.T, page string, base *url.URL) string {
+	t.Helper()
+	tree, err := Parse(strings.NewReader(page), base)
+	if err != nil {
+		t.Fatalf("Parse %q, %v", page, err)
+	}
+	var sb strings.Builder
+	tree.WriteTo(&sb)
+	return sb.String()
+}
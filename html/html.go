@@ -0,0 +1,215 @@
+// Package html renders the Gemtext node tree as semantic HTML5.
+package html
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/shrmpy/gmi"
+)
+
+// Renderer holds the options to convert a tree into HTML
+type Renderer struct {
+	// Rewrite decides the href of links (nil keeps the link URL)
+	Rewrite func(*url.URL) string
+	// Page wraps the body in a full document (see Template)
+	Page bool
+	// Title of the full page, defaults to the first heading
+	Title string
+	// CSS is the stylesheet of the full page, defaults to DefaultCSS
+	CSS string
+	// Lang attribute of the full page
+	Lang string
+	// Template replaces the full page template, it receives PageData
+	Template *template.Template
+	// IDs gives headings the id attribute of HeadingID
+	IDs bool
+}
+
+// PageData is the input of the full page template
+type PageData struct {
+	Title string
+	Lang  string
+	CSS   template.CSS
+	Body  template.HTML
+}
+
+const DefaultCSS = `body { max-width: 40em; margin: 0 auto; padding: 1em; line-height: 1.5; font-family: sans-serif; }
+pre { overflow-x: auto; padding: 0.5em; background: #f4f4f4; }
+blockquote { border-left: 3px solid #ccc; margin-left: 0; padding-left: 1em; }
+p.link { margin: 0.2em 0; }
+p.link a::before { content: "\21D2\00A0"; }
+`
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+{{.CSS}}</style>
+</head>
+<body>
+{{.Body}}</body>
+</html>
+`))
+
+// Render writes the HTML fragment of the tree with default options
+func Render(w io.Writer, t *gmi.Tree) error {
+	var r Renderer
+	return r.Render(w, t)
+}
+
+// Render writes the tree as HTML (full page when Page is set)
+func (r *Renderer) Render(w io.Writer, t *gmi.Tree) error {
+	if !r.Page {
+		bw := bufio.NewWriter(w)
+		r.body(bw, t)
+		return bw.Flush()
+	}
+	var (
+		sb   strings.Builder
+		tmpl = pageTemplate
+		data = PageData{Title: r.Title, Lang: r.Lang, CSS: template.CSS(r.CSS)}
+	)
+	r.body(&sb, t)
+	data.Body = template.HTML(sb.String())
+	if data.Title == "" {
+		data.Title = t.Title()
+	}
+	if data.Lang == "" {
+		data.Lang = "en"
+	}
+	if data.CSS == "" {
+		data.CSS = template.CSS(DefaultCSS)
+	}
+	if r.Template != nil {
+		tmpl = r.Template
+	}
+	return tmpl.Execute(w, data)
+}
+
+// the open element of consecutive lines (ul or blockquote)
+type group string
+
+const (
+	groupNone  group = ""
+	groupList  group = "ul"
+	groupQuote group = "blockquote"
+)
+
+func (r *Renderer) body(w io.Writer, t *gmi.Tree) {
+	var open = groupNone
+	// close the group when the line type changes
+	toggle := func(next group) {
+		if open == next {
+			return
+		}
+		if open != groupNone {
+			fmt.Fprintf(w, "</%s>\n", open)
+		}
+		if next != groupNone {
+			fmt.Fprintf(w, "<%s>\n", next)
+		}
+		open = next
+	}
+	if t == nil || t.Root == nil {
+		return
+	}
+	for _, n := range t.Root.Nodes {
+		switch no := n.(type) {
+		case *gmi.ItemNode:
+			toggle(groupList)
+			fmt.Fprintf(w, "<li>%s</li>\n", esc(no.Item))
+		case *gmi.QuoteNode:
+			toggle(groupQuote)
+			fmt.Fprintf(w, "<p>%s</p>\n", esc(no.Quote))
+		case *gmi.HeadingNode:
+			toggle(groupNone)
+			if r.IDs {
+				fmt.Fprintf(w, "<h%[1]d id=\"%[3]s\">%[2]s</h%[1]d>\n", level(no.Level), esc(no.Heading), HeadingID(no))
+				continue
+			}
+			fmt.Fprintf(w, "<h%[1]d>%[2]s</h%[1]d>\n", level(no.Level), esc(no.Heading))
+		case *gmi.LinkNode:
+			toggle(groupNone)
+			href, name := r.link(no)
+			fmt.Fprintf(w, "<p class=\"link\"><a href=\"%s\">%s</a></p>\n", esc(href), esc(name))
+		case *gmi.PromptNode:
+			// the input is asked for when the link is followed
+			toggle(groupNone)
+			href, name := r.link(&gmi.LinkNode{URL: no.URL, Friendly: no.Friendly})
+			fmt.Fprintf(w, "<p class=\"prompt\"><a href=\"%s\">%s</a></p>\n", esc(href), esc(name))
+		case *gmi.PreformatNode:
+			toggle(groupNone)
+			if no.Alt != "" {
+				fmt.Fprintf(w, "<pre aria-label=\"%s\">", esc(no.Alt))
+			} else {
+				io.WriteString(w, "<pre>")
+			}
+			fmt.Fprintf(w, "%s</pre>\n", esc(strings.TrimSuffix(string(no.Body), "\n")))
+		case *gmi.TextNode:
+			toggle(groupNone)
+			if text := string(no.Text); strings.TrimSpace(text) != "" {
+				fmt.Fprintf(w, "<p>%s</p>\n", esc(text))
+			}
+		}
+	}
+	toggle(groupNone)
+}
+
+// href and the visible name of the link
+func (r *Renderer) link(n *gmi.LinkNode) (string, string) {
+	var href, name string
+	if n.URL != nil {
+		href = n.URL.String()
+		if r.Rewrite != nil {
+			href = r.Rewrite(n.URL)
+		}
+	}
+	name = n.Friendly
+	if name == "" {
+		name = href
+		if n.URL != nil {
+			name = n.URL.String()
+		}
+	}
+	return safeHref(href), name
+}
+
+// script URLs in a capsule must not become active on the web
+func safeHref(href string) string {
+	lu, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "#"
+	}
+	switch strings.ToLower(lu.Scheme) {
+	case "javascript", "vbscript", "data":
+		return "#"
+	}
+	return href
+}
+
+// HeadingID is the fragment of the heading (from its byte position)
+func HeadingID(n *gmi.HeadingNode) string {
+	return fmt.Sprintf("h%d", n.Position())
+}
+
+func level(lv int) int {
+	if lv < 1 {
+		return 1
+	}
+	if lv > 3 {
+		return 3
+	}
+	return lv
+}
+
+func esc(s string) string {
+	return template.HTMLEscapeString(s)
+}
@@ -0,0 +1,130 @@
+package html
+
+import (
+	"html/template"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/shrmpy/gmi"
+)
+
+func render(t *testing.T, r *Renderer, page string) string {
+	t.Helper()
+	tree, err := gmi.Parse(page)
+	if err != nil {
+		t.Fatalf("Parse %q, %v", page, err)
+	}
+	var sb strings.Builder
+	if err = r.Render(&sb, tree); err != nil {
+		t.Fatalf("Render %q, %v", page, err)
+	}
+	return sb.String()
+}
+
+func TestRender(t *testing.T) {
+	var tests = []struct {
+		name string
+		page string
+		want string
+	}{
+		{"headings", "# One\n## Two\n### Three\n", "<h1>One</h1>\n<h2>Two</h2>\n<h3>Three</h3>\n"},
+		{"text", "plain text\n", "<p>plain text</p>\n"},
+		{"blank lines", "\n   \n", ""},
+		{"list", "* one\n* two\n", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n"},
+		{"quote", "> one\n> two\n", "<blockquote>\n<p>one</p>\n<p>two</p>\n</blockquote>\n"},
+		{"groups change", "* item\n> quote\ntext\n* item\n", "<ul>\n<li>item</li>\n</ul>\n<blockquote>\n<p>quote</p>\n</blockquote>\n<p>text</p>\n<ul>\n<li>item</li>\n</ul>\n"},
+		{"link", "=> /page.gmi Page\n", "<p class=\"link\"><a href=\"/page.gmi\">Page</a></p>\n"},
+		{"link without name", "=> gemini://example.org/\n", "<p class=\"link\"><a href=\"gemini://example.org/\">gemini://example.org/</a></p>\n"},
+		{"prompt", "=: /search Search\n", "<p class=\"prompt\"><a href=\"/search\">Search</a></p>\n"},
+		{"preformat", "```alt\nline 1\n  line 2\n```\n", "<pre aria-label=\"alt\">line 1\n  line 2</pre>\n"},
+		{"preformat without alt", "```\n```\n", "<pre></pre>\n"},
+	}
+	for _, tt := range tests {
+		if got := render(t, &Renderer{}, tt.page); got != tt.want {
+			t.Errorf("%s: HTML %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// the text of the page never becomes markup
+func TestRenderEscape(t *testing.T) {
+	var tests = []struct {
+		name string
+		page string
+		want string
+	}{
+		{"heading", "# A <b> & \"c\"\n", "<h1>A &lt;b&gt; &amp; &#34;c&#34;</h1>\n"},
+		{"text", "<script>alert('x')</script>\n", "<p>&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt;</p>\n"},
+		{"item", "* <li>\n", "<ul>\n<li>&lt;li&gt;</li>\n</ul>\n"},
+		{"quote", "> </blockquote>\n", "<blockquote>\n<p>&lt;/blockquote&gt;</p>\n</blockquote>\n"},
+		{"link", "=> /a?x=1&y=\"2\" A & B\n", "<p class=\"link\"><a href=\"/a?x=1&amp;y=&#34;2&#34;\">A &amp; B</a></p>\n"},
+		{"prompt", "=: /s <Search>\n", "<p class=\"prompt\"><a href=\"/s\">&lt;Search&gt;</a></p>\n"},
+		{"preformat", "```a\"lt\n<pre> & \"x\"\n```\n", "<pre aria-label=\"a&#34;lt\">&lt;pre&gt; &amp; &#34;x&#34;</pre>\n"},
+		{"javascript", "=> javascript:alert(1) Evil\n", "<p class=\"link\"><a href=\"#\">Evil</a></p>\n"},
+		{"scheme case", "=> JavaScript:alert(1) Evil\n", "<p class=\"link\"><a href=\"#\">Evil</a></p>\n"},
+		{"data", "=> data:text/html,<b>x</b> Data\n", "<p class=\"link\"><a href=\"#\">Data</a></p>\n"},
+	}
+	for _, tt := range tests {
+		if got := render(t, &Renderer{}, tt.page); got != tt.want {
+			t.Errorf("%s: HTML %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRenderOptions(t *testing.T) {
+	var proxy = func(u *url.URL) string {
+		return "/proxy?" + url.QueryEscape(u.String())
+	}
+	var tests = []struct {
+		name string
+		r    *Renderer
+		page string
+		want string
+	}{
+		{"rewrite", &Renderer{Rewrite: proxy}, "=> gemini://example.org/ Ex\n", "<p class=\"link\"><a href=\"/proxy?gemini%3A%2F%2Fexample.org%2F\">Ex</a></p>\n"},
+		// the name is the URL of the page, not the rewritten one
+		{"rewrite without name", &Renderer{Rewrite: proxy}, "=> gemini://example.org/\n", "<p class=\"link\"><a href=\"/proxy?gemini%3A%2F%2Fexample.org%2F\">gemini://example.org/</a></p>\n"},
+		{"rewrite to script", &Renderer{Rewrite: func(*url.URL) string { return "javascript:void(0)" }}, "=> /a A\n", "<p class=\"link\"><a href=\"#\">A</a></p>\n"},
+		{"ids", &Renderer{IDs: true}, "text\n# Title\n", "<p>text</p>\n<h1 id=\"h5\">Title</h1>\n"},
+	}
+	for _, tt := range tests {
+		if got := render(t, tt.r, tt.page); got != tt.want {
+			t.Errorf("%s: HTML %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRenderPage(t *testing.T) {
+	var custom = template.Must(template.New("custom").Parse("{{.Lang}}|{{.Title}}|{{.CSS}}|{{.Body}}"))
+	var tests = []struct {
+		name string
+		r    *Renderer
+		want []string
+	}{
+		{"defaults", &Renderer{Page: true}, []string{
+			"<!DOCTYPE html>",
+			`<html lang="en">`,
+			"<title>T &lt;x&gt;</title>",
+			"max-width: 40em",
+			"<body>\n<h1>T &lt;x&gt;</h1>\n<p class=\"link\"><a href=\"/a\">A</a></p>\n</body>",
+		}},
+		{"options", &Renderer{Page: true, Title: "Mine", Lang: "de", CSS: "p { color: red; }"}, []string{
+			`<html lang="de">`,
+			"<title>Mine</title>",
+			"<style>\np { color: red; }</style>",
+		}},
+		{"template", &Renderer{Page: true, Template: custom}, []string{
+			"en|T &lt;x&gt;|",
+			"|<h1>T &lt;x&gt;</h1>\n",
+		}},
+	}
+	for _, tt := range tests {
+		var got = render(t, tt.r, "# T <x>\n=> /a A\n")
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: page %q does not contain %q", tt.name, got, want)
+			}
+		}
+	}
+}
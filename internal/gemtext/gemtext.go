@@ -0,0 +1,88 @@
+// Package gemtext writes the blocks of the converters into Gemtext,
+// the links found inside a block follow the block as link lines.
+package gemtext
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shrmpy/gmi"
+)
+
+// Link found inside a block
+type Link struct {
+	URL  string
+	Name string
+}
+
+// Writer separates the blocks with blank lines and holds the links
+// until the end of their block
+type Writer struct {
+	Doc     *gmi.Document
+	links   []Link
+	written bool // any block was written
+}
+
+func NewWriter() *Writer {
+	return &Writer{Doc: gmi.NewDocument()}
+}
+
+// Block starts the block, a blank line separates it from the last one
+func (w *Writer) Block() {
+	if w.written {
+		w.Doc.Blank()
+	}
+	w.written = true
+}
+
+// AddLinks queues the links until WriteLinks
+func (w *Writer) AddLinks(links ...Link) {
+	w.links = append(w.links, links...)
+}
+
+// WriteLinks writes the queued links as link lines
+func (w *Writer) WriteLinks() {
+	for _, lnk := range w.links {
+		w.Doc.Link(lnk.URL, lnk.Name)
+	}
+	w.links = nil
+}
+
+// Table writes the rows as a preformat block with aligned columns, a
+// nil row is drawn as the rule under the header
+func (w *Writer) Table(rows [][]string) {
+	var widths []int
+	for _, cells := range rows {
+		for k, cell := range cells {
+			if k >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(cell); n > widths[k] {
+				widths[k] = n
+			}
+		}
+	}
+	var sb strings.Builder
+	for _, cells := range rows {
+		var line strings.Builder
+		for k, n := range widths {
+			if cells != nil && k >= len(cells) {
+				break
+			}
+			if k > 0 {
+				line.WriteString(" | ")
+			}
+			if cells == nil {
+				line.WriteString(strings.Repeat("-", n))
+				continue
+			}
+			line.WriteString(cells[k])
+			line.WriteString(strings.Repeat(" ", n-utf8.RuneCountInString(cells[k])))
+		}
+		// the last cell is not padded
+		sb.WriteString(strings.TrimRight(line.String(), " "))
+		sb.WriteString("\n")
+	}
+	w.Block()
+	w.Doc.Pre("table", sb.String())
+}
@@ -0,0 +1,124 @@
+package gmi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// jsonNode is the stable JSON shape of one node,
+// text is the line content without its prefix
+type jsonNode struct {
+	Type     string `json:"type"`
+	Pos      Pos    `json:"pos"`
+	Line     int    `json:"line"`
+	Text     string `json:"text,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Friendly string `json:"friendly,omitempty"`
+	Level    int    `json:"level,omitempty"`
+	Alt      string `json:"alt,omitempty"`
+}
+type jsonTree struct {
+	Nodes []jsonNode `json:"nodes"`
+}
+
+var jsonTypes = map[NodeType]string{
+	NodeText:      "text",
+	NodeLink:      "link",
+	NodeHeading:   "heading",
+	NodeItem:      "item",
+	NodeQuote:     "quote",
+	NodePreformat: "preformat",
+	NodePrompt:    "prompt",
+}
+
+// MarshalJSON encodes the nodes of the page in order
+func (t *Tree) MarshalJSON() ([]byte, error) {
+	var (
+		doc  = jsonTree{Nodes: []jsonNode{}}
+		line = 1
+	)
+	if t.Root != nil {
+		for _, n := range t.Root.Nodes {
+			jn := jsonNode{Type: jsonTypes[n.Type()], Pos: n.Position(), Line: line}
+			switch no := n.(type) {
+			case *TextNode:
+				jn.Text = string(no.Text)
+			case *LinkNode:
+				if no.URL != nil {
+					jn.URL = no.URL.String()
+				}
+				jn.Friendly = no.Friendly
+			case *PromptNode:
+				if no.URL != nil {
+					jn.URL = no.URL.String()
+				}
+				jn.Friendly = no.Friendly
+			case *HeadingNode:
+				jn.Text, jn.Level = no.Heading, no.Level
+			case *ItemNode:
+				jn.Text = no.Item
+			case *QuoteNode:
+				jn.Text = no.Quote
+			case *PreformatNode:
+				jn.Text, jn.Alt = string(no.Body), no.Alt
+				// the toggles and body rows
+				line += strings.Count(jn.Text, "\n") + 1
+			default:
+				return nil, fmt.Errorf("JSON unsupported node type %T", n)
+			}
+			doc.Nodes = append(doc.Nodes, jn)
+			line++
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON rebuilds the nodes, the line numbers are derived
+// from the node order so they are not read back
+func (t *Tree) UnmarshalJSON(data []byte) error {
+	var doc jsonTree
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	t.Root = t.newList(0)
+	for i, jn := range doc.Nodes {
+		var n Node
+		switch jn.Type {
+		case "text":
+			n = t.newText(jn.Pos, jn.Text)
+		case "link":
+			lnk := t.newLink(jn.Pos, "")
+			lu, err := url.Parse(jn.URL)
+			if err != nil {
+				return fmt.Errorf("JSON node %d link URL, %w", i, err)
+			}
+			lnk.URL, lnk.Friendly = lu, jn.Friendly
+			n = lnk
+		case "prompt":
+			pr := t.newPrompt(jn.Pos, "")
+			lu, err := url.Parse(jn.URL)
+			if err != nil {
+				return fmt.Errorf("JSON node %d prompt URL, %w", i, err)
+			}
+			pr.URL, pr.Friendly = lu, jn.Friendly
+			n = pr
+		case "heading":
+			n = t.newHeading(jn.Pos, jn.Level, jn.Text, "")
+		case "item":
+			n = t.newItem(jn.Pos, jn.Text, "")
+		case "quote":
+			n = t.newQuote(jn.Pos, jn.Text, "")
+		case "preformat":
+			pre := t.newPreformat(jn.Pos, jn.Alt)
+			pre.Body = []byte(jn.Text)
+			n = pre
+		default:
+			return fmt.Errorf("JSON node %d has unknown type %q", i, jn.Type)
+		}
+		fillText(n)
+		t.Root.append(n)
+	}
+	return nil
+}
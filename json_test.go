@@ -0,0 +1,97 @@
+package gmi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// the field names are the stable schema, a change breaks consumers
+func TestMarshalJSONSchema(t *testing.T) {
+	var tests = []struct {
+		page string
+		want string
+	}{
+		{"", `{"nodes":[]}`},
+		{"# Title\n", `{"nodes":[{"type":"heading","pos":0,"line":1,"text":"Title","level":1}]}`},
+		{"### Three\n", `{"nodes":[{"type":"heading","pos":0,"line":1,"text":"Three","level":3}]}`},
+		{"text\n", `{"nodes":[{"type":"text","pos":0,"line":1,"text":"text"}]}`},
+		{"=> /a A\n", `{"nodes":[{"type":"link","pos":0,"line":1,"url":"/a","friendly":"A"}]}`},
+		{"=> gemini://example.org/\n", `{"nodes":[{"type":"link","pos":0,"line":1,"url":"gemini://example.org/"}]}`},
+		{"=: /s Search\n", `{"nodes":[{"type":"prompt","pos":0,"line":1,"url":"/s","friendly":"Search"}]}`},
+		{"* item\n", `{"nodes":[{"type":"item","pos":0,"line":1,"text":"item"}]}`},
+		{"> quote\n", `{"nodes":[{"type":"quote","pos":0,"line":1,"text":"quote"}]}`},
+		{"```alt\npre 1\npre 2\n```\n", `{"nodes":[{"type":"preformat","pos":0,"line":1,"text":"pre 1\npre 2\n","alt":"alt"}]}`},
+		// the lines after a preformat block count its toggles and rows
+		{"# T\n```\na\nb\n```\nafter\n", `{"nodes":[{"type":"heading","pos":0,"line":1,"text":"T","level":1},{"type":"preformat","pos":4,"line":2,"text":"a\nb\n"},{"type":"text","pos":16,"line":6,"text":"after"}]}`},
+		{"<b> & \"q\"\n", `{"nodes":[{"type":"text","pos":0,"line":1,"text":"\u003cb\u003e \u0026 \"q\""}]}`},
+	}
+	for _, tt := range tests {
+		tree, err := Parse(tt.page)
+		if err != nil {
+			t.Fatalf("Parse %q, %v", tt.page, err)
+		}
+		buf, err := json.Marshal(tree)
+		if err != nil {
+			t.Fatalf("Marshal %q, %v", tt.page, err)
+		}
+		if string(buf) != tt.want {
+			t.Errorf("%q: JSON %s, want %s", tt.page, buf, tt.want)
+		}
+	}
+}
+
+// decoded trees serialize to the same page as the parsed ones
+func TestJSONRoundTrip(t *testing.T) {
+	var pages = []string{
+		strings.Join(corpus, "\n") + "\n",
+		"# Title\ntext\n=> /a A\n=: /s Search\n* item\n> quote\n```alt\npre 1\npre 2\n```\nafter\n",
+		"=> gemini://example.org/path?q=a%20b#frag Query\n",
+		"* unicode ✓ ünïcödé\n",
+	}
+	for _, page := range pages {
+		tree, err := Parse(page)
+		if err != nil {
+			t.Fatalf("Parse %q, %v", page, err)
+		}
+		buf, err := json.Marshal(tree)
+		if err != nil {
+			t.Fatalf("Marshal %q, %v", page, err)
+		}
+		var back Tree
+		if err = json.Unmarshal(buf, &back); err != nil {
+			t.Fatalf("Unmarshal %s, %v", buf, err)
+		}
+		var want, got strings.Builder
+		tree.WriteTo(&want)
+		back.WriteTo(&got)
+		if got.String() != want.String() {
+			t.Errorf("%q: decoded page %q, want %q", page, got.String(), want.String())
+		}
+		again, err := json.Marshal(&back)
+		if err != nil {
+			t.Fatalf("Marshal decoded %q, %v", page, err)
+		}
+		if string(again) != string(buf) {
+			t.Errorf("%q: JSON of the decoded tree %s, want %s", page, again, buf)
+		}
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	var tests = []struct {
+		name string
+		data string
+	}{
+		{"syntax", `{"nodes":[`},
+		{"unknown type", `{"nodes":[{"type":"table"}]}`},
+		{"link URL", `{"nodes":[{"type":"link","url":"%zz"}]}`},
+		{"prompt URL", `{"nodes":[{"type":"prompt","url":"%zz"}]}`},
+	}
+	for _, tt := range tests {
+		var tree Tree
+		if err := json.Unmarshal([]byte(tt.data), &tree); err == nil {
+			t.Errorf("%s: Unmarshal %s succeeded", tt.name, tt.data)
+		}
+	}
+}
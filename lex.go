@@ -58,6 +58,7 @@ const (
 	itemList    // list prefix (*)
 	itemBlock   // blockquote prefix (>)
 	itemPrefmt  // preformat prefix (```)
+	itemPrompt  // input link prefix (=:)
 	itemNil     // the untyped nil constant, easiest to treat as a keyword
 
 )
@@ -68,6 +69,7 @@ var key = map[string]itemType{
 	"*":   itemList,
 	">":   itemBlock,
 	"```": itemPrefmt,
+	"=:":  itemPrompt,
 	"nil": itemNil,
 }
 
@@ -88,6 +90,7 @@ type lexer struct {
 	parenDepth int       // nesting depth of ( ) exprs
 	line       int       // 1+number of newlines seen
 	startLine  int       // start line of this item
+	pretoggle  bool      // inside preformatted text
 }
 
 // next returns the next rune in the input.
@@ -195,57 +198,106 @@ func (l *lexer) run() {
 // state functions
 //
 
-// scan until a line type prefix (link|prefmt), otherwise plain text
+// scan until a line type prefix, otherwise plain text
 func lexPlain(l *lexer) stateFn {
-	var (
-		lf     int
-		offset Pos
-		row    string
-	)
 	l.width = 0
-	lf = strings.Index(l.input[l.pos:], "\n")
-	if lf < 0 {
-		// newline is nonexistent
-		l.pos = Pos(len(l.input))
+	if int(l.pos) >= len(l.input) {
 		// Correctly reached EOF
-		if l.pos > l.start {
-			l.line += strings.Count(l.input[l.start:l.pos], "\n")
-			l.emit(itemText)
-		}
 		l.emit(itemEOF)
 		return nil
 	}
-	offset = Pos(lf)
 	// line type is derived from first-three chars
-	row = l.input[l.pos : l.pos+offset]
-	if strings.HasPrefix(row, LinkLine.String()) {
+	row := l.input[l.pos : l.pos+l.lineEnd()]
+	if l.pretoggle {
+		// inside preformat only the closing toggle has meaning
+		if strings.HasPrefix(row, PrefmtLine.String()) {
+			return lexPrefmt
+		}
+		return lexText
+	}
+	switch {
+	case strings.HasPrefix(row, LinkLine.String()):
 		return lexLeftLink
+	case strings.HasPrefix(row, PromptLine.String()):
+		return lexLeftPrompt
+	case strings.HasPrefix(row, PrefmtLine.String()):
+		return lexPrefmt
+	case strings.HasPrefix(row, HeadingLine.String()):
+		return lexHeading
+	case strings.HasPrefix(row, ListLine.String()+" "):
+		return lexList
+	case strings.HasPrefix(row, BlockLine.String()):
+		return lexQuote
 	}
-	// plain text line
-	l.pos += offset
+	return lexText
+}
+
+// plain text line (or a line of the preformat body)
+func lexText(l *lexer) stateFn {
+	l.pos += l.lineEnd()
 	l.emit(itemText)
-	l.accept("\n")
+	l.acceptEOL()
 	l.ignore()
 	return lexPlain
 }
 
+//#[#[#]][<whitespace>]<heading text>
+func lexHeading(l *lexer) stateFn {
+	for lv := 0; lv < 3 && l.accept("#"); lv++ {
+	}
+	l.emit(itemHeading)
+	return lexRemain
+}
+
+//*<space><list item text>
+func lexList(l *lexer) stateFn {
+	l.pos += Pos(len(ListLine.String()))
+	l.emit(itemList)
+	return lexRemain
+}
+
+//>[<whitespace>]<quote text>
+func lexQuote(l *lexer) stateFn {
+	l.pos += Pos(len(BlockLine.String()))
+	l.emit(itemBlock)
+	return lexRemain
+}
+
+//```[<alt text>] toggles preformat mode
+func lexPrefmt(l *lexer) stateFn {
+	l.pos += Pos(len(PrefmtLine.String()))
+	l.emit(itemPrefmt)
+	l.pretoggle = !l.pretoggle
+	return lexRemain
+}
+
+// text to the right of the line prefix, always emitted (even empty)
+// so the parser knows it belongs to the prefix
+func lexRemain(l *lexer) stateFn {
+	l.acceptRun(" \t")
+	l.ignore()
+	return lexText
+}
+
 //=>[<whitespace>]<URL>[<whitespace><USER-FRIENDLY LINK NAME>]
 func lexLeftLink(l *lexer) stateFn {
 	l.pos += Pos(len(LinkLine.String()))
 	l.emit(itemLink)
 	return lexLinkURL
 }
+
+//=:[<whitespace>]<URL>[<whitespace><USER-FRIENDLY LINK NAME>] (Spartan input)
+func lexLeftPrompt(l *lexer) stateFn {
+	l.pos += Pos(len(PromptLine.String()))
+	l.emit(itemPrompt)
+	return lexLinkURL
+}
 func lexLinkURL(l *lexer) stateFn {
 	// skip spaces for now
 	l.acceptRun(" \t")
 	l.ignore()
-	lf := strings.Index(l.input[l.pos:], "\n")
-	if lf < 0 {
-		// possibly eof is the line terminator (improper syntax?)
-		// fail now, ? can be more forgiving in future
-		return l.errorf("Line %d does not end in newline.", l.line)
-	}
-	offset := Pos(lf)
+	// the row may end at eof instead of newline
+	offset := l.lineEnd()
 	// inspect the row to right of the prefix
 	remain := l.input[l.pos : l.pos+offset]
 	// spaces separate the URL and friendly name
@@ -254,7 +306,7 @@ func lexLinkURL(l *lexer) stateFn {
 		// zero spaces right of url
 		l.pos += offset
 		l.emit(itemLinkURL)
-		l.accept("\n")
+		l.acceptEOL()
 		l.ignore()
 		return lexPlain
 	}
@@ -265,18 +317,44 @@ func lexLinkURL(l *lexer) stateFn {
 	l.acceptRun(" \t")
 	l.ignore()
 	// recalc row end since we advanced cursor position
-	lf = strings.Index(l.input[l.pos:], "\n")
 	// friendly name may be empty since it's optional
-	if lf > 0 {
-		l.pos += Pos(lf)
+	if offset = l.lineEnd(); offset > 0 {
+		l.pos += offset
 		l.emit(itemLinkDesc)
 	}
-	l.accept("\n")
+	l.acceptEOL()
 	l.ignore()
 
 	return lexPlain
 }
 
+// lineEnd is the offset from the cursor to the end of the row
+// (either the newline or the end of input), the CR of a CRLF
+// line ending (or a lone CR at the end of input) is not part of
+// the row
+func (l *lexer) lineEnd() Pos {
+	if lf := strings.Index(l.input[l.pos:], "\n"); lf >= 0 {
+		if lf > 0 && l.input[int(l.pos)+lf-1] == '\r' {
+			return Pos(lf - 1)
+		}
+		return Pos(lf)
+	}
+	var rest = Pos(len(l.input)) - l.pos
+	if strings.HasSuffix(l.input, "\r") && rest > 0 {
+		return rest - 1
+	}
+	return rest
+}
+
+// acceptEOL consumes the line ending (LF, CRLF or the CR which
+// ends the input)
+func (l *lexer) acceptEOL() {
+	if strings.HasPrefix(l.input[l.pos:], "\r\n") || l.input[l.pos:] == "\r" {
+		l.pos++
+	}
+	l.accept("\n")
+}
+
 func isSpace(r rune) bool {
 	return r == ' ' || r == '\t'
 }
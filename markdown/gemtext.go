@@ -0,0 +1,457 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/shrmpy/gmi"
+	"github.com/shrmpy/gmi/internal/gemtext"
+)
+
+// Parse converts CommonMark into a Gemtext tree; inline links move
+// to link lines after their paragraph, nested lists are flattened,
+// tables become preformat blocks and images become links.
+func Parse(text string) (*gmi.Tree, error) {
+	var c = &converter{
+		Writer: gemtext.NewWriter(),
+		defs:   make(map[string]string),
+	}
+	var lines = c.definitions(strings.Split(normalize(text), "\n"))
+	c.convert(lines)
+	return c.Doc.Tree()
+}
+
+type converter struct {
+	*gemtext.Writer
+	defs map[string]string // reference link definitions
+	para []string          // lines of the open paragraph
+	list bool              // inside a list
+}
+
+var (
+	reATX      = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))??(?:[ \t]+#+)?[ \t]*$`)
+	reFence    = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([^`]*)$")
+	reBreak    = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	reSetext1  = regexp.MustCompile(`^ {0,3}=+[ \t]*$`)
+	reSetext2  = regexp.MustCompile(`^ {0,3}-+[ \t]*$`)
+	reQuote    = regexp.MustCompile(`^ {0,3}> ?(.*)$`)
+	reItem     = regexp.MustCompile(`^([ \t]*)([-*+]|[0-9]{1,9}[.)])(?:[ \t]+(.*))?$`)
+	reCode     = regexp.MustCompile(`^(?: {4}|\t)(.*)$`)
+	reDef      = regexp.MustCompile(`^ {0,3}\[([^\]]+)\]:[ \t]*<?([^ \t>]+)>?(?:[ \t]+(?:"[^"]*"|'[^']*'|\([^)]*\)))?[ \t]*$`)
+	reDelimRow = regexp.MustCompile(`^[ \t]*\|?[ \t]*:?-+:?[ \t]*(\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+)
+
+func normalize(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n")
+}
+
+// collect the reference definitions and drop their lines
+func (c *converter) definitions(lines []string) []string {
+	var (
+		keep  []string
+		fence string
+	)
+	for _, ln := range lines {
+		if m := reFence.FindStringSubmatch(ln); m != nil {
+			if fence == "" {
+				fence = m[1]
+			} else if strings.HasPrefix(m[1], fence[:1]) && len(m[1]) >= len(fence) {
+				fence = ""
+			}
+		}
+		if m := reDef.FindStringSubmatch(ln); fence == "" && m != nil {
+			c.defs[strings.ToLower(m[1])] = m[2]
+			continue
+		}
+		keep = append(keep, ln)
+	}
+	return keep
+}
+
+func (c *converter) convert(lines []string) {
+	for i := 0; i < len(lines); i++ {
+		var ln = lines[i]
+		switch {
+		case strings.TrimSpace(ln) == "":
+			c.flush()
+			continue
+
+		case reFence.MatchString(ln):
+			i = c.fenced(lines, i)
+			continue
+
+		case reATX.MatchString(ln):
+			m := reATX.FindStringSubmatch(ln)
+			c.heading(len(m[1]), m[2])
+			continue
+
+		case len(c.para) > 0 && !c.list && reSetext1.MatchString(ln):
+			c.setext(1)
+			continue
+
+		case len(c.para) > 0 && !c.list && reSetext2.MatchString(ln):
+			c.setext(2)
+			continue
+
+		case reBreak.MatchString(ln):
+			c.flush()
+			c.endList()
+			continue
+
+		case i+1 < len(lines) && strings.Contains(ln, "|") &&
+			strings.Contains(lines[i+1], "|") && reDelimRow.MatchString(lines[i+1]):
+			i = c.table(lines, i)
+			continue
+
+		case reQuote.MatchString(ln):
+			i = c.quote(lines, i)
+			continue
+
+		case reItem.MatchString(ln):
+			m := reItem.FindStringSubmatch(ln)
+			c.item(m[2], m[3])
+			continue
+
+		case len(c.para) == 0 && !c.list && reCode.MatchString(ln):
+			i = c.indented(lines, i)
+			continue
+		}
+		if c.list && len(c.para) == 0 && ln == strings.TrimLeft(ln, " \t") {
+			// paragraph after the blank line which ended the list
+			c.endList()
+		}
+		// paragraph text (or continuation of the last list item)
+		c.para = append(c.para, strings.TrimSpace(ln))
+	}
+	c.flush()
+	c.endList()
+}
+
+// write the open paragraph (or list item) and its links
+func (c *converter) flush() {
+	if len(c.para) == 0 {
+		return
+	}
+	text, links := c.inline(strings.Join(c.para, " "))
+	// removed images can leave double spaces
+	text = strings.Join(strings.Fields(text), " ")
+	c.para = nil
+	c.AddLinks(links...)
+	if c.list {
+		c.Doc.List(text)
+		return
+	}
+	if strings.TrimSpace(text) != "" {
+		c.Block()
+		c.Doc.Text(text)
+	}
+	c.WriteLinks()
+}
+
+// the links of the list follow the entire list
+func (c *converter) endList() {
+	if !c.list {
+		return
+	}
+	c.flush()
+	c.list = false
+	c.WriteLinks()
+}
+
+func (c *converter) heading(level int, text string) {
+	c.flush()
+	c.endList()
+	c.Block()
+	text, links := c.inline(text)
+	c.Doc.Heading(level, text)
+	c.AddLinks(links...)
+	c.WriteLinks()
+}
+
+func (c *converter) setext(level int) {
+	var text = strings.Join(c.para, " ")
+	c.para = nil
+	c.heading(level, text)
+}
+
+// nested lists are flattened, ordered items keep their number
+func (c *converter) item(marker string, text string) {
+	c.flush()
+	if !c.list {
+		c.Block()
+		c.list = true
+	}
+	if !strings.ContainsAny(marker, "-*+") {
+		text = marker + " " + text
+	}
+	c.para = []string{strings.TrimSpace(text)}
+}
+
+func (c *converter) fenced(lines []string, i int) int {
+	c.flush()
+	c.endList()
+	var (
+		m     = reFence.FindStringSubmatch(lines[i])
+		fence = m[1]
+		alt   = strings.TrimSpace(m[2])
+		body  []string
+	)
+	for i++; i < len(lines); i++ {
+		if mc := reFence.FindStringSubmatch(lines[i]); mc != nil &&
+			strings.HasPrefix(mc[1], fence[:1]) && len(mc[1]) >= len(fence) &&
+			strings.TrimSpace(mc[2]) == "" {
+			break
+		}
+		body = append(body, lines[i])
+	}
+	c.Block()
+	c.Doc.Pre(alt, strings.Join(body, "\n"))
+	return i
+}
+
+func (c *converter) indented(lines []string, i int) int {
+	var body []string
+	for ; i < len(lines); i++ {
+		if m := reCode.FindStringSubmatch(lines[i]); m != nil {
+			body = append(body, m[1])
+			continue
+		}
+		if strings.TrimSpace(lines[i]) != "" {
+			break
+		}
+		body = append(body, "")
+	}
+	// trailing blank lines belong to the next block
+	for len(body) > 0 && strings.TrimSpace(body[len(body)-1]) == "" {
+		body = body[:len(body)-1]
+	}
+	c.Block()
+	c.Doc.Pre("", strings.Join(body, "\n"))
+	return i - 1
+}
+
+// consecutive quote lines, blank quote lines separate paragraphs
+func (c *converter) quote(lines []string, i int) int {
+	c.flush()
+	c.endList()
+	c.Block()
+	var rows []string
+	for ; i < len(lines); i++ {
+		m := reQuote.FindStringSubmatch(lines[i])
+		if m == nil {
+			break
+		}
+		var inner = strings.TrimSpace(m[1])
+		// nested quotes are flattened
+		for strings.HasPrefix(inner, ">") {
+			inner = strings.TrimSpace(inner[1:])
+		}
+		if inner == "" {
+			c.quoteRows(rows)
+			rows = nil
+			continue
+		}
+		rows = append(rows, inner)
+	}
+	c.quoteRows(rows)
+	c.WriteLinks()
+	return i - 1
+}
+
+func (c *converter) quoteRows(rows []string) {
+	if len(rows) == 0 {
+		return
+	}
+	text, links := c.inline(strings.Join(rows, " "))
+	c.Doc.Quote(text)
+	c.AddLinks(links...)
+}
+
+// table rows become aligned columns in a preformat block
+func (c *converter) table(lines []string, i int) int {
+	c.flush()
+	c.endList()
+	var (
+		rows  [][]string
+		links []gemtext.Link
+	)
+	for ; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" || !strings.Contains(lines[i], "|") {
+			break
+		}
+		if len(rows) == 1 && reDelimRow.MatchString(lines[i]) {
+			// the delimiter row is redrawn by the writer
+			rows = append(rows, nil)
+			continue
+		}
+		var cells = splitRow(lines[i])
+		for k, cell := range cells {
+			text, found := c.inline(cell)
+			links = append(links, found...)
+			cells[k] = text
+		}
+		rows = append(rows, cells)
+	}
+	c.Table(rows)
+	c.AddLinks(links...)
+	c.WriteLinks()
+	return i - 1
+}
+
+// cells of the table row (escaped pipes are kept)
+func splitRow(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	if strings.HasSuffix(row, "|") && !strings.HasSuffix(row, `\|`) {
+		row = row[:len(row)-1]
+	}
+	var (
+		cells []string
+		cur   strings.Builder
+	)
+	for k := 0; k < len(row); k++ {
+		if row[k] == '\\' && k+1 < len(row) && row[k+1] == '|' {
+			cur.WriteByte('|')
+			k++
+			continue
+		}
+		if row[k] == '|' {
+			cells = append(cells, strings.TrimSpace(cur.String()))
+			cur.Reset()
+			continue
+		}
+		cur.WriteByte(row[k])
+	}
+	return append(cells, strings.TrimSpace(cur.String()))
+}
+
+// inline strips the link syntax from the text and returns the links
+func (c *converter) inline(text string) (string, []gemtext.Link) {
+	var (
+		sb    strings.Builder
+		links []gemtext.Link
+	)
+	for k := 0; k < len(text); k++ {
+		switch ch := text[k]; {
+		case ch == '\\' && k+1 < len(text) && strings.IndexByte(punct, text[k+1]) >= 0:
+			sb.WriteByte(text[k+1])
+			k++
+
+		case ch == '`':
+			// code span keeps its content verbatim
+			run := len(text[k:]) - len(strings.TrimLeft(text[k:], "`"))
+			fence := text[k : k+run]
+			if end := strings.Index(text[k+run:], fence); end >= 0 {
+				sb.WriteString(strings.TrimSpace(text[k+run : k+run+end]))
+				k += run + end + run - 1
+				continue
+			}
+			sb.WriteString(fence)
+			k += run - 1
+
+		case ch == '!' && k+1 < len(text) && text[k+1] == '[':
+			if alt, dest, next, ok := c.linkAt(text, k+1); ok {
+				// images become links (named by the alt text)
+				alt, _ = c.inline(alt)
+				if alt == "" {
+					alt = dest
+				}
+				links = append(links, gemtext.Link{URL: dest, Name: alt})
+				k = next - 1
+				continue
+			}
+			sb.WriteByte(ch)
+
+		case ch == '[':
+			if label, dest, next, ok := c.linkAt(text, k); ok {
+				name, inner := c.inline(label)
+				sb.WriteString(name)
+				links = append(links, inner...)
+				links = append(links, gemtext.Link{URL: dest, Name: name})
+				k = next - 1
+				continue
+			}
+			sb.WriteByte(ch)
+
+		case ch == '<':
+			// autolink <scheme:...>
+			if end := strings.IndexByte(text[k:], '>'); end > 0 {
+				dest := text[k+1 : k+end]
+				if strings.Contains(dest, ":") && !strings.ContainsAny(dest, " <") {
+					sb.WriteString(dest)
+					links = append(links, gemtext.Link{URL: dest, Name: dest})
+					k += end
+					continue
+				}
+			}
+			sb.WriteByte(ch)
+
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String(), links
+}
+
+const punct = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// linkAt reads [label](dest "title"), [label][ref], [label][] or [ref]
+// starting at the open bracket, next is the offset after the link
+func (c *converter) linkAt(text string, open int) (label string, dest string, next int, ok bool) {
+	var close = matching(text, open, '[', ']')
+	if close < 0 {
+		return
+	}
+	label = text[open+1 : close]
+	next = close + 1
+	if next < len(text) && text[next] == '(' {
+		end := matching(text, next, '(', ')')
+		if end < 0 {
+			return
+		}
+		inner := strings.TrimSpace(text[next+1 : end])
+		if strings.HasPrefix(inner, "<") {
+			if gt := strings.IndexByte(inner, '>'); gt > 0 {
+				inner = inner[1:gt]
+			}
+		} else if sp := strings.IndexAny(inner, " \t"); sp >= 0 {
+			// drop the title
+			inner = inner[:sp]
+		}
+		return label, inner, end + 1, true
+	}
+	var ref = label
+	if next < len(text) && text[next] == '[' {
+		end := strings.IndexByte(text[next:], ']')
+		if end < 0 {
+			return
+		}
+		if r := text[next+1 : next+end]; r != "" {
+			ref = r
+		}
+		next += end + 1
+	}
+	if dest, ok = c.defs[strings.ToLower(ref)]; ok {
+		return label, dest, next, true
+	}
+	return "", "", 0, false
+}
+
+// index of the bracket which closes the one at open (-1 when none)
+func matching(text string, open int, left byte, right byte) int {
+	var depth int
+	for k := open; k < len(text); k++ {
+		switch text[k] {
+		case '\\':
+			k++
+		case left:
+			depth++
+		case right:
+			if depth--; depth == 0 {
+				return k
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,105 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		name string
+		md   string
+		want string
+	}{
+		{"atx", "# Title #\n### Three\n###### Six\n", "# Title\n\n### Three\n\n### Six\n"},
+		{"setext", "Setext\n===\n\nSub\n---\n", "# Setext\n\n## Sub\n"},
+		{"paragraph", "one\ntwo\n\nthree\n", "one two\n\nthree\n"},
+		{"inline code", "Some `code` and \\*lit\\*.\n", "Some code and *lit*.\n"},
+		{"quote", "> quoted\n> more\n", "> quoted more\n"},
+		{"fenced", "```go\nfmt.Println()\n```\n", "```go\nfmt.Println()\n```\n"},
+		{"indented", "    indented\n", "```\nindented\n```\n"},
+		{"break", "a\n\n---\n\nb\n", "a\n\nb\n"},
+		{"crlf", "# T\r\n\r\ntext\r\n", "# T\n\ntext\n"},
+	}
+	for _, tt := range tests {
+		if got := parse(t, tt.md); got != tt.want {
+			t.Errorf("%s: gemtext %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseLinks(t *testing.T) {
+	var tests = []struct {
+		name string
+		md   string
+		want string
+	}{
+		{"inline", "See [the site](https://example.org/) now.\n\nnext\n", "See the site now.\n=> https://example.org/ the site\n\nnext\n"},
+		{"reference", "See [ref][r].\n\n[r]: /ref \"T\"\n", "See ref.\n=> /ref ref\n"},
+		{"collapsed and shortcut", "[collapsed][] and [shortcut]\n\n[collapsed]: /c\n[shortcut]: /s\n", "collapsed and shortcut\n=> /c collapsed\n=> /s shortcut\n"},
+		{"undefined reference", "[missing][nope]\n", "[missing][nope]\n"},
+		{"autolink", "Auto <https://a.example/x>\n", "Auto https://a.example/x\n=> https://a.example/x https://a.example/x\n"},
+		{"image", "![logo](/logo.png) text\n", "text\n=> /logo.png logo\n"},
+		{"destination", "[a](</with space>) [b](/p \"title\")\n", "a b\n=> /with%20space a\n=> /p b\n"},
+		{"heading", "# [Heading link](/h)\n", "# Heading link\n=> /h Heading link\n"},
+		{"quote", "> quoted [q](/q)\n> more\n", "> quoted q more\n=> /q q\n"},
+		{"code block", "```\n[not](/link)\n```\n", "```\n[not](/link)\n```\n"},
+	}
+	for _, tt := range tests {
+		if got := parse(t, tt.md); got != tt.want {
+			t.Errorf("%s: gemtext %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseLists(t *testing.T) {
+	var tests = []struct {
+		name string
+		md   string
+		want string
+	}{
+		{"markers", "- dash\n* star\n+ plus\n", "* dash\n* star\n* plus\n"},
+		{"nested", "- one\n  - nested\n    - deeper\n- two\n", "* one\n* nested\n* deeper\n* two\n"},
+		{"ordered", "1. first\n2) second\n", "* 1. first\n* 2) second\n"},
+		{"loose", "- loose\n\n- items\n", "* loose\n* items\n"},
+		{"continuation", "- item\n  goes on\n- next\n", "* item goes on\n* next\n"},
+		{"links after the list", "- item with [link](/l)\n- plain\n\npara\n", "* item with link\n* plain\n=> /l link\n\npara\n"},
+	}
+	for _, tt := range tests {
+		if got := parse(t, tt.md); got != tt.want {
+			t.Errorf("%s: gemtext %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTables(t *testing.T) {
+	var tests = []struct {
+		name string
+		md   string
+		want string
+	}{
+		{"aligned", "| a | b |\n|---|:-:|\n| 1 | long cell |\n", "```table\na | b\n- | ---------\n1 | long cell\n```\n"},
+		{"no outer pipes", "a | b\n--|--\n1 | 2\n", "```table\na | b\n- | -\n1 | 2\n```\n"},
+		{"short row", "| a | b |\n|---|---|\n| 1 |\n", "```table\na | b\n- | -\n1\n```\n"},
+		{"links after the table", "| [l](/t) | x \\| y |\n|---|---|\n\nnext\n", "```table\nl | x | y\n- | -----\n```\n=> /t l\n\nnext\n"},
+		{"unicode width", "| ü | b |\n|---|---|\n| ääää | c |\n", "```table\nü    | b\n---- | -\nääää | c\n```\n"},
+		// a pipe without the delimiter row is text
+		{"not a table", "a | b\nc | d\n", "a | b c | d\n"},
+	}
+	for _, tt := range tests {
+		if got := parse(t, tt.md); got != tt.want {
+			t.Errorf("%s: gemtext %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func parse(t *testing.T, md string) string {
+	t.Helper()
+	tree, err := Parse(md)
+	if err != nil {
+		t.Fatalf("Parse %q, %v", md, err)
+	}
+	var sb strings.Builder
+	tree.WriteTo(&sb)
+	return sb.String()
+}
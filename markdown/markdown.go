@@ -0,0 +1,199 @@
+// Package markdown converts between the Gemtext node tree and CommonMark.
+package markdown
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/shrmpy/gmi"
+)
+
+// Renderer holds the options to convert a tree into CommonMark
+type Renderer struct {
+	// ReferenceLinks writes [name][n] with the URL definitions at the end
+	ReferenceLinks bool
+	// Rewrite decides the destination of links (nil keeps the link URL)
+	Rewrite func(*url.URL) string
+}
+
+// Render writes the CommonMark of the tree with default options
+func Render(w io.Writer, t *gmi.Tree) error {
+	var r Renderer
+	return r.Render(w, t)
+}
+
+// the block of consecutive lines which is being written
+type block int
+
+const (
+	blockNone block = iota
+	blockList
+	blockLinks
+	blockQuote
+)
+
+// Render writes the tree as CommonMark
+func (r *Renderer) Render(w io.Writer, t *gmi.Tree) error {
+	var (
+		bw   = bufio.NewWriter(w)
+		open = blockNone
+		refs []string
+	)
+	// blocks are separated by a blank line
+	toggle := func(next block) {
+		if open != blockNone && open != next {
+			bw.WriteString("\n")
+		}
+		open = next
+	}
+	if t != nil && t.Root != nil {
+		for _, n := range t.Root.Nodes {
+			switch no := n.(type) {
+			case *gmi.HeadingNode:
+				toggle(blockNone)
+				fmt.Fprintf(bw, "%s %s\n\n", strings.Repeat("#", headingLevel(no.Level)), escapeHeading(no.Heading))
+			case *gmi.ItemNode:
+				toggle(blockList)
+				fmt.Fprintf(bw, "- %s\n", escape(no.Item))
+			case *gmi.QuoteNode:
+				toggle(blockQuote)
+				// hard line break keeps the quote lines apart
+				fmt.Fprintf(bw, "> %s  \n", escape(no.Quote))
+			case *gmi.LinkNode, *gmi.PromptNode:
+				toggle(blockLinks)
+				// another bullet char keeps it apart from an adjacent list
+				dest, name := r.link(asLink(no))
+				if r.ReferenceLinks {
+					refs = append(refs, dest)
+					fmt.Fprintf(bw, "* [%s][%d]\n", escape(name), len(refs))
+				} else {
+					fmt.Fprintf(bw, "* [%s](%s)\n", escape(name), destination(dest))
+				}
+			case *gmi.PreformatNode:
+				toggle(blockNone)
+				writeFence(bw, no)
+			case *gmi.TextNode:
+				toggle(blockNone)
+				// each gemtext line is its own paragraph
+				if text := string(no.Text); strings.TrimSpace(text) != "" {
+					fmt.Fprintf(bw, "%s\n\n", escape(text))
+				}
+			}
+		}
+	}
+	toggle(blockNone)
+	for i, dest := range refs {
+		fmt.Fprintf(bw, "[%d]: %s\n", i+1, destination(dest))
+	}
+	return bw.Flush()
+}
+
+// gemtext has three levels (a decoded tree can have any)
+func headingLevel(level int) int {
+	if level < 1 {
+		return 1
+	}
+	if level > 3 {
+		return 3
+	}
+	return level
+}
+
+// the # run after a space at the end would be read as the closing
+// sequence
+func escapeHeading(text string) string {
+	text = escape(text)
+	var trim = strings.TrimRight(text, "#")
+	if len(trim) < len(text) && (trim == "" || strings.HasSuffix(trim, " ") || strings.HasSuffix(trim, "\t")) {
+		text = text[:len(text)-1] + `\#`
+	}
+	return text
+}
+
+// input links (Spartan) are written like links
+func asLink(n gmi.Node) *gmi.LinkNode {
+	if pr, ok := n.(*gmi.PromptNode); ok {
+		return &gmi.LinkNode{URL: pr.URL, Friendly: pr.Friendly}
+	}
+	return n.(*gmi.LinkNode)
+}
+
+// destination and the visible name of the link
+func (r *Renderer) link(n *gmi.LinkNode) (string, string) {
+	var dest string
+	if n.URL != nil {
+		dest = n.URL.String()
+		if r.Rewrite != nil {
+			dest = r.Rewrite(n.URL)
+		}
+	}
+	var name = n.Friendly
+	if name == "" {
+		name = dest
+		if n.URL != nil {
+			name = n.URL.String()
+		}
+	}
+	return dest, name
+}
+
+// fenced code block, the fence is longer than any backtick run
+// of the body and the alt text becomes the info string
+func writeFence(bw *bufio.Writer, n *gmi.PreformatNode) {
+	var (
+		body  = string(n.Body)
+		fence = "```"
+	)
+	for strings.Contains(body, fence) {
+		fence += "`"
+	}
+	var info = strings.ReplaceAll(strings.TrimSpace(n.Alt), "`", "")
+	fmt.Fprintf(bw, "%s%s\n%s", fence, info, body)
+	if body != "" && !strings.HasSuffix(body, "\n") {
+		bw.WriteString("\n")
+	}
+	fmt.Fprintf(bw, "%s\n\n", fence)
+}
+
+// link destination in angle brackets when it has spaces or parens
+func destination(dest string) string {
+	if strings.ContainsAny(dest, " ()<>") {
+		r := strings.NewReplacer("<", "%3C", ">", "%3E")
+		return "<" + r.Replace(dest) + ">"
+	}
+	return dest
+}
+
+// inline metacharacters of CommonMark
+var inline = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`,
+	`[`, `\[`, `]`, `\]`, `<`, `\<`, `>`, `\>`,
+	`&`, `\&`, `~`, `\~`, `|`, `\|`,
+)
+
+// escape the text so it cannot start a block or inline construct
+func escape(text string) string {
+	text = inline.Replace(text)
+	trim := strings.TrimLeft(text, " \t")
+	lead := text[:len(text)-len(trim)]
+	if len(lead) > 3 || strings.Contains(lead, "\t") {
+		// would become an indented code block
+		lead = ""
+	}
+	switch {
+	case trim == "":
+		return lead
+	case strings.ContainsRune("#+-=", rune(trim[0])):
+		// heading, list item or setext underline
+		return lead + `\` + trim
+	}
+	// ordered list marker (1. or 1))
+	var digits = len(trim) - len(strings.TrimLeft(trim, "0123456789"))
+	if digits > 0 && digits < len(trim) && (trim[digits] == '.' || trim[digits] == ')') {
+		return lead + trim[:digits] + `\` + trim[digits:]
+	}
+	return lead + trim
+}
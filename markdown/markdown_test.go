@@ -0,0 +1,144 @@
+package markdown
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/shrmpy/gmi"
+)
+
+func TestRenderHeading(t *testing.T) {
+	var tests = []struct {
+		level int
+		text  string
+		want  string
+	}{
+		{1, "Title", "# Title"},
+		{0, "Zero", "# Zero"},
+		{-2, "Negative", "# Negative"},
+		{3, "Three", "### Three"},
+		{6, "Six", "### Six"},
+		{2, "Issue #", `## Issue \#`},
+		{2, "Rank ##", `## Rank #\#`},
+		{1, "C#", "# C#"},
+		{1, "##", `# \##`},
+		{1, "# hash first", `# \# hash first`},
+	}
+	for _, tt := range tests {
+		var sb strings.Builder
+		if err := Render(&sb, headingTree(t, tt.level, tt.text)); err != nil {
+			t.Fatalf("Render, %v", err)
+		}
+		if got := strings.TrimSpace(sb.String()); got != tt.want {
+			t.Errorf("heading %d %q is %q, want %q", tt.level, tt.text, got, tt.want)
+		}
+		// the converter reads back the same text
+		back, err := Parse(sb.String())
+		if err != nil {
+			t.Fatalf("Parse, %v", err)
+		}
+		if hs := back.Headings(); len(hs) != 1 || hs[0].Heading != tt.text {
+			t.Errorf("heading %q reads back as %v", tt.text, hs)
+		}
+	}
+}
+
+// tree of the one heading, decoded from JSON so the level is not clamped
+func headingTree(t *testing.T, level int, text string) *gmi.Tree {
+	t.Helper()
+	var (
+		tree gmi.Tree
+		data = fmt.Sprintf(`{"nodes":[{"type":"heading","level":%d,"text":%q}]}`, level, text)
+	)
+	if err := json.Unmarshal([]byte(data), &tree); err != nil {
+		t.Fatalf("Unmarshal, %v", err)
+	}
+	return &tree
+}
+
+func render(t *testing.T, r *Renderer, page string) string {
+	t.Helper()
+	tree, err := gmi.Parse(page)
+	if err != nil {
+		t.Fatalf("Parse %q, %v", page, err)
+	}
+	var sb strings.Builder
+	if err = r.Render(&sb, tree); err != nil {
+		t.Fatalf("Render %q, %v", page, err)
+	}
+	return sb.String()
+}
+
+func TestRender(t *testing.T) {
+	var tests = []struct {
+		name string
+		page string
+		want string
+	}{
+		{"headings", "# One\n## Two\n### Three\n", "# One\n\n## Two\n\n### Three\n\n"},
+		{"text", "plain text\n", "plain text\n\n"},
+		{"blank lines", "\n   \n", ""},
+		{"list", "* one\n* two\n", "- one\n- two\n\n"},
+		{"quote", "> one\n> two\n", "> one  \n> two  \n\n"},
+		{"link", "=> /page.gmi Page\n", "* [Page](/page.gmi)\n\n"},
+		{"link without name", "=> gemini://example.org/\n", "* [gemini://example.org/](gemini://example.org/)\n\n"},
+		{"prompt", "=: /search Search\n", "* [Search](/search)\n\n"},
+		{"links next to a list", "* item\n=> /a A\n* item\n", "- item\n\n* [A](/a)\n\n- item\n\n"},
+		{"preformat", "```alt\nline 1\n  line 2\n```\n", "```alt\nline 1\n  line 2\n```\n\n"},
+		{"preformat with a fence", "```\ncode ``` x\n```\n", "````\ncode ``` x\n````\n\n"},
+		{"preformat alt backticks", "```a`l`t\nx\n```\n", "```alt\nx\n```\n\n"},
+	}
+	for _, tt := range tests {
+		if got := render(t, &Renderer{}, tt.page); got != tt.want {
+			t.Errorf("%s: markdown %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// the text of the page never becomes markup
+func TestRenderEscape(t *testing.T) {
+	var tests = []struct {
+		name string
+		page string
+		want string
+	}{
+		{"inline", "*bold* _u_ <b> & ~ | \\ `c`\n", "\\*bold\\* \\_u\\_ \\<b\\> \\& \\~ \\| \\\\ \\`c\\`\n\n"},
+		{"link text", "[x](y)\n", "\\[x\\](y)\n\n"},
+		{"heading marker", "  #tag\n", "  \\#tag\n\n"},
+		{"list markers", "+ plus\n- minus\n", "\\+ plus\n\n\\- minus\n\n"},
+		{"setext underline", "= eq\n", "\\= eq\n\n"},
+		{"ordered list", "1. one\n2) two\n", "1\\. one\n\n2\\) two\n\n"},
+		{"item", "* - nested\n", "- \\- nested\n\n"},
+		{"quote", "> > nested\n", "> \\> nested  \n\n"},
+		{"link name", "=> /a [x] *y*\n", "* [\\[x\\] \\*y\\*](/a)\n\n"},
+		{"destination parens", "=> /a(b) Paren\n", "* [Paren](</a(b)>)\n\n"},
+		{"heading text", "## <i>x</i>\n", "## \\<i\\>x\\</i\\>\n\n"},
+		// the body of a code block is literal
+		{"preformat", "```\n*x* <b>\n```\n", "```\n*x* <b>\n```\n\n"},
+	}
+	for _, tt := range tests {
+		if got := render(t, &Renderer{}, tt.page); got != tt.want {
+			t.Errorf("%s: markdown %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRenderOptions(t *testing.T) {
+	var tests = []struct {
+		name string
+		r    *Renderer
+		page string
+		want string
+	}{
+		{"reference links", &Renderer{ReferenceLinks: true}, "=> /a A\n=: /b?x=1 B\n", "* [A][1]\n* [B][2]\n\n[1]: /a\n[2]: /b?x=1\n"},
+		{"rewrite", &Renderer{Rewrite: func(u *url.URL) string { return "https://proxy.example/" + u.Host }}, "=> gemini://example.org/ Ex\n", "* [Ex](https://proxy.example/example.org)\n\n"},
+	}
+	for _, tt := range tests {
+		if got := render(t, tt.r, tt.page); got != tt.want {
+			t.Errorf("%s: markdown %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -12,6 +12,7 @@ var textFormat = "%s" // Changed to "%q" in tests for better error messages.
 type Node interface {
 	Type() NodeType
 	String() string
+	Position() Pos
 	writeTo(*strings.Builder)
 }
 
@@ -32,11 +33,14 @@ func (t NodeType) Type() NodeType {
 }
 
 const (
-	NodeText    NodeType = iota // Plain text.
-	NodeLink                    // Link.
-	NodeList                    // A list of nodes.
-	gmPretoggle                 // Preformat toggle switch.
-	gmPreformat                 // Preformat text body.
+	NodeText      NodeType = iota // Plain text.
+	NodeLink                      // Link.
+	NodeList                      // A list of nodes.
+	NodeHeading                   // Heading.
+	NodeItem                      // List item.
+	NodeQuote                     // Quote.
+	NodePreformat                 // Preformat block (between toggles).
+	NodePrompt                    // Input link (Spartan).
 	gmBlank
 )
 
@@ -63,6 +67,7 @@ func (l *ListNode) String() string {
 func (l *ListNode) writeTo(sb *strings.Builder) {
 	for _, n := range l.Nodes {
 		n.writeTo(sb)
+		sb.WriteString("\n")
 	}
 }
 
@@ -80,7 +85,7 @@ func (n *TextNode) String() string {
 	return fmt.Sprintf(textFormat, n.Text)
 }
 func (n *TextNode) writeTo(sb *strings.Builder) {
-	sb.WriteString(n.String())
+	sb.WriteString(escapeLine(string(n.Text)))
 }
 
 // LinkNode holds hyperlink.
@@ -101,7 +106,166 @@ func (n LinkNode) String() string {
 	return fmt.Sprintf("%s %s", n.URL, n.Friendly)
 }
 func (n LinkNode) writeTo(sb *strings.Builder) {
-	sb.WriteString(n.String())
+	sb.WriteString(LinkLine.String())
+	if n.URL != nil {
+		sb.WriteString(" ")
+		sb.WriteString(n.URL.String())
+	}
+	if n.Friendly != "" {
+		sb.WriteString(" ")
+		sb.WriteString(n.Friendly)
+	}
+}
+
+// PromptNode holds an input link, the reader asks for the text
+// which is sent to the URL (Spartan).
+type PromptNode struct {
+	NodeType
+	Pos
+	URL      *url.URL
+	Friendly string
+	Text     []byte // The original textual representation of the input.
+}
+
+func (t *Tree) newPrompt(pos Pos, text string) *PromptNode {
+	return &PromptNode{NodeType: NodePrompt, Pos: pos, Text: []byte(text)}
+}
+func (n PromptNode) String() string {
+	return fmt.Sprintf("%s %s", n.URL, n.Friendly)
+}
+func (n PromptNode) writeTo(sb *strings.Builder) {
+	sb.WriteString(PromptLine.String())
+	if n.URL != nil {
+		sb.WriteString(" ")
+		sb.WriteString(n.URL.String())
+	}
+	if n.Friendly != "" {
+		sb.WriteString(" ")
+		sb.WriteString(n.Friendly)
+	}
+}
+
+// HeadingNode holds a heading line.
+type HeadingNode struct {
+	NodeType
+	Pos
+	Level   int    // Count of # (1-3).
+	Heading string // Heading text without the prefix.
+	Text    []byte // The original textual representation of the input.
+}
+
+func (t *Tree) newHeading(pos Pos, level int, heading string, text string) *HeadingNode {
+	return &HeadingNode{NodeType: NodeHeading, Pos: pos, Level: level, Heading: heading, Text: []byte(text)}
+}
+func (n *HeadingNode) String() string {
+	return fmt.Sprintf(textFormat, n.Text)
+}
+func (n *HeadingNode) writeTo(sb *strings.Builder) {
+	var level = n.Level
+	if level < 1 {
+		level = 1
+	} else if level > 3 {
+		level = 3
+	}
+	sb.WriteString(strings.Repeat(HeadingLine.String(), level))
+	writeRemain(sb, n.Heading)
+}
+
+// ItemNode holds a list item line.
+type ItemNode struct {
+	NodeType
+	Pos
+	Item string // Item text without the prefix.
+	Text []byte // The original textual representation of the input.
+}
+
+func (t *Tree) newItem(pos Pos, item string, text string) *ItemNode {
+	return &ItemNode{NodeType: NodeItem, Pos: pos, Item: item, Text: []byte(text)}
+}
+func (n *ItemNode) String() string {
+	return fmt.Sprintf(textFormat, n.Text)
+}
+func (n *ItemNode) writeTo(sb *strings.Builder) {
+	// the space is mandatory for list items
+	sb.WriteString(ListLine.String())
+	sb.WriteString(" ")
+	sb.WriteString(n.Item)
+}
+
+// QuoteNode holds a quote line.
+type QuoteNode struct {
+	NodeType
+	Pos
+	Quote string // Quote text without the prefix.
+	Text  []byte // The original textual representation of the input.
+}
+
+func (t *Tree) newQuote(pos Pos, quote string, text string) *QuoteNode {
+	return &QuoteNode{NodeType: NodeQuote, Pos: pos, Quote: quote, Text: []byte(text)}
+}
+func (n *QuoteNode) String() string {
+	return fmt.Sprintf(textFormat, n.Text)
+}
+func (n *QuoteNode) writeTo(sb *strings.Builder) {
+	sb.WriteString(BlockLine.String())
+	writeRemain(sb, n.Quote)
+}
+
+// PreformatNode holds the lines between the preformat toggles.
+type PreformatNode struct {
+	NodeType
+	Pos
+	Alt  string // Alt text from the opening toggle.
+	Body []byte // Lines without the toggles (each ends in newline).
+	Text []byte // The original textual representation of the input.
+}
+
+func (t *Tree) newPreformat(pos Pos, alt string) *PreformatNode {
+	return &PreformatNode{NodeType: NodePreformat, Pos: pos, Alt: alt}
+}
+func (n *PreformatNode) String() string {
+	return fmt.Sprintf(textFormat, n.Text)
+}
+func (n *PreformatNode) writeTo(sb *strings.Builder) {
+	sb.WriteString(PrefmtLine.String())
+	sb.WriteString(n.Alt)
+	sb.WriteString("\n")
+	for _, row := range strings.SplitAfter(string(n.Body), "\n") {
+		if row == "" {
+			continue
+		}
+		if strings.HasPrefix(row, PrefmtLine.String()) {
+			// would close the block early
+			sb.WriteString(" ")
+		}
+		sb.WriteString(row)
+	}
+	if len(n.Body) != 0 && !strings.HasSuffix(string(n.Body), "\n") {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(PrefmtLine.String())
+}
+
+// single space separates the prefix from the text
+func writeRemain(sb *strings.Builder, text string) {
+	if text != "" {
+		sb.WriteString(" ")
+		sb.WriteString(text)
+	}
+}
+
+// plain text which starts like a line type prefix gains
+// a leading space, otherwise the parser reads another type
+func escapeLine(text string) string {
+	for _, lt := range []LineType{LinkLine, PromptLine, HeadingLine, BlockLine, PrefmtLine} {
+		if strings.HasPrefix(text, lt.String()) {
+			return " " + text
+		}
+	}
+	if strings.HasPrefix(text, ListLine.String()+" ") {
+		return " " + text
+	}
+	return text
 }
 
 // BlankNode represents empty line.
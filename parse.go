@@ -3,12 +3,14 @@ package gmi
 import (
 	"fmt"
 	"net/url"
+	"strings"
 )
 
 type Tree struct {
 	lex       *lexer
 	pretoggle bool
 	Root      *ListNode // top-level node of our tree
+	Verbatim  bool      // WriteTo keeps the whitespace of the input lines
 	peekCount int
 	token     [3]item
 }
@@ -23,11 +25,12 @@ func Parse(text string) (*Tree, error) {
 }
 
 // Parse accepts GEMtext and digests into structured (hier/tree) data
-func (t *Tree) Parse() error {
+func (t *Tree) Parse() (err error) {
+	defer t.recover(&err)
 	t.Root = t.newList(t.peek().pos)
 
 	for t.peek().typ != itemEOF {
-		switch n := t.textOrLink(); n.Type() {
+		switch n := t.lineNode(); n.Type() {
 
 		default:
 			t.Root.append(n)
@@ -36,18 +39,42 @@ func (t *Tree) Parse() error {
 	return nil
 }
 
-//TODO core defines [text|blank|link|pre] lines
-func (t *Tree) textOrLink() Node {
+// recover turns the parse panics into the returned error
+func (t *Tree) recover(errp *error) {
+	e := recover()
+	if e == nil {
+		return
+	}
+	if _, ok := e.(error); !ok {
+		panic(e)
+	}
+	if t.lex != nil {
+		// release the lexing goroutine
+		t.lex.drain()
+	}
+	*errp = e.(error)
+}
+
+// core defines [text|link|prompt|heading|list|quote|pre] lines
+func (t *Tree) lineNode() Node {
 	switch token := t.next(); token.typ {
 	case itemText:
 		return t.newText(token.pos, token.val)
 	case itemLink:
 		return link(t, token)
+	case itemPrompt:
+		return prompt(t, token)
+	case itemHeading:
+		return heading(t, token)
+	case itemList:
+		return listItem(t, token)
+	case itemBlock:
+		return quote(t, token)
+	case itemPrefmt:
+		return preformat(t, token)
 	default:
-		// only support subset for now
 		panic(fmt.Errorf("unexpected %s in input", token))
 	}
-	return nil
 }
 
 // next returns the next token.
@@ -73,9 +100,24 @@ func (t *Tree) peek() item {
 // construct link node from 2/3 tokens
 func link(t *Tree, token item) Node {
 	n := t.newLink(token.pos, token.val)
+	n.URL, n.Friendly, n.Text = linkParts(t, token)
+	return n
+}
+
+// construct prompt node from 2/3 tokens (same layout as the link)
+func prompt(t *Tree, token item) Node {
+	n := t.newPrompt(token.pos, token.val)
+	n.URL, n.Friendly, n.Text = linkParts(t, token)
+	return n
+}
+
+// URL and the optional friendly name to the right of the prefix
+func linkParts(t *Tree, token item) (*url.URL, string, []byte) {
 	var (
-		err error
-		it  item
+		err      error
+		it       item
+		lu       *url.URL
+		friendly string
 	)
 	//url
 	it = t.next()
@@ -83,16 +125,87 @@ func link(t *Tree, token item) Node {
 		panic(fmt.Errorf("problem with link input %s ", token))
 	}
 
-	n.URL, err = url.Parse(it.val)
+	lu, err = url.Parse(it.val)
 	if err != nil {
 		panic(fmt.Errorf("problem with link URL %s ", it))
 	}
 	//friendly description is optional
+	last := it
 	it = t.peek()
 	if it.typ == itemLinkDesc {
 		t.next()
-		n.Friendly = it.val
+		friendly = it.val
+		last = it
+	}
+	return lu, friendly, []byte(t.source(token, last))
+}
+
+// text to the right of a line prefix
+func remain(t *Tree, token item) item {
+	it := t.next()
+	if it.typ != itemText {
+		panic(fmt.Errorf("problem with %s line input", token))
 	}
+	return it
+}
 
+// original input from the token start to the end of the last token
+func (t *Tree) source(from item, to item) string {
+	return t.lex.input[from.pos : to.pos+Pos(len(to.val))]
+}
+
+// construct heading node from 2 tokens
+func heading(t *Tree, token item) Node {
+	it := remain(t, token)
+	return t.newHeading(token.pos, len(token.val), it.val, t.source(token, it))
+}
+
+// construct list item node from 2 tokens
+func listItem(t *Tree, token item) Node {
+	it := remain(t, token)
+	return t.newItem(token.pos, it.val, t.source(token, it))
+}
+
+// construct quote node from 2 tokens
+func quote(t *Tree, token item) Node {
+	it := remain(t, token)
+	return t.newQuote(token.pos, it.val, t.source(token, it))
+}
+
+// construct preformat node from the toggles and body lines
+func preformat(t *Tree, token item) Node {
+	var (
+		alt  = remain(t, token)
+		last = alt
+		body []string
+		n    = t.newPreformat(token.pos, alt.val)
+	)
+	for {
+		it := t.next()
+		if it.typ == itemText {
+			body = append(body, it.val+"\n")
+			last = it
+			continue
+		}
+		if it.typ == itemPrefmt {
+			// closing toggle (trailing text is ignored)
+			last = remain(t, it)
+			break
+		}
+		if it.typ == itemEOF {
+			// unterminated block ends with the input
+			t.backup(it)
+			break
+		}
+		panic(fmt.Errorf("unexpected %s in preformat", it))
+	}
+	n.Body = []byte(strings.Join(body, ""))
+	n.Text = []byte(t.source(token, last))
 	return n
 }
+
+// backup puts back the token which next consumed
+func (t *Tree) backup(it item) {
+	t.token[0] = it
+	t.peekCount = 1
+}
@@ -0,0 +1,29 @@
+package gmi
+
+import "testing"
+
+func TestParseCRLF(t *testing.T) {
+	tree, err := Parse("# Title\r\n=> gemini://x\r\n=> /a  A link\r\ntext\r\n```alt\r\npre\r\n```\r\n")
+	if err != nil {
+		t.Fatalf("Parse, %v", err)
+	}
+	var nodes = tree.Root.Nodes
+	if len(nodes) != 5 {
+		t.Fatalf("Parse nodes %d, want 5", len(nodes))
+	}
+	if hd := nodes[0].(*HeadingNode); hd.Heading != "Title" {
+		t.Errorf("heading %q, want %q", hd.Heading, "Title")
+	}
+	if lnk := nodes[1].(*LinkNode); lnk.URL.String() != "gemini://x" {
+		t.Errorf("link URL %q, want %q", lnk.URL, "gemini://x")
+	}
+	if lnk := nodes[2].(*LinkNode); lnk.Friendly != "A link" {
+		t.Errorf("link name %q, want %q", lnk.Friendly, "A link")
+	}
+	if txt := nodes[3].(*TextNode); string(txt.Text) != "text" {
+		t.Errorf("text %q, want %q", txt.Text, "text")
+	}
+	if pre := nodes[4].(*PreformatNode); pre.Alt != "alt" || string(pre.Body) != "pre\n" {
+		t.Errorf("preformat %q %q, want %q %q", pre.Alt, pre.Body, "alt", "pre\n")
+	}
+}
@@ -0,0 +1,91 @@
+package gmi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Finger and Nex are small plain TCP protocols which capsules link to,
+// their text is converted to gemtext like the gopher pages
+const (
+	fingerPort = "79"
+	nexPort    = "1900"
+)
+
+// open the plain TCP connection (no TLS) to the host of the URL
+func (c *control) dialPlain(u *url.URL, port string) error {
+	var host = u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	var (
+		err    error
+		dialer net.Dialer
+	)
+	if c.conn, err = dialer.DialContext(c.ctx, "tcp", host); err != nil {
+		return fmt.Errorf("Failed to connect: %w", err)
+	}
+	c.bind()
+	return nil
+}
+
+// send the request line and read until the server closes
+func (c *control) exchange(u *url.URL, port string, req string) ([]byte, error) {
+	if err := c.dialPlain(u, port); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(c.conn, req+"\r\n"); err != nil {
+		c.preRedirect()
+		return nil, fmt.Errorf("Request failed, %w", err)
+	}
+	buf, err := io.ReadAll(c.conn)
+	if err != nil {
+		c.preRedirect()
+		return nil, fmt.Errorf("Failed to read response %w", err)
+	}
+	return buf, nil
+}
+
+// finger://host/user (or finger://user@host), the answer is
+// shown as a preformat block
+func (c *control) finger(u *url.URL) (*bufio.Reader, error) {
+	var user = strings.TrimPrefix(u.Path, "/")
+	if u.User != nil {
+		user = u.User.Username()
+	}
+	buf, err := c.exchange(u, fingerPort, user)
+	if err != nil {
+		return nil, err
+	}
+	var doc = NewDocument().Pre("finger "+user, plainText(buf))
+	return c.gemtext(u, doc.tree)
+}
+
+// nex://host/path, directories (trailing slash) are listings of
+// link lines, other files are text
+func (c *control) nex(u *url.URL) (*bufio.Reader, error) {
+	var sel = u.EscapedPath()
+	if sel == "" {
+		sel = "/"
+	}
+	buf, err := c.exchange(u, nexPort, sel)
+	if err != nil {
+		return nil, err
+	}
+	if ext := path.Ext(u.Path); strings.HasSuffix(sel, "/") || ext == ".gmi" || ext == ".gemini" {
+		c.base, c.meta = u, "text/gemini"
+		return bufio.NewReader(strings.NewReader(string(buf))), nil
+	}
+	var doc = NewDocument().Pre(path.Base(u.Path), plainText(buf))
+	return c.gemtext(u, doc.tree)
+}
+
+// line endings of the network text are normalized to newline
+func plainText(buf []byte) string {
+	return strings.ReplaceAll(string(buf), "\r\n", "\n")
+}
@@ -0,0 +1,78 @@
+package gmi
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// requests of the finger and nex exchanges against a local server
+func TestPlain(t *testing.T) {
+	var srv = servePlain(t, func(r *bufio.Reader) (string, string) {
+		line, _ := r.ReadString('\n')
+		var answers = map[string]string{
+			"":            "Users on: ann\r\n",
+			"ann":         "Login: ann\r\nPlan: gardening\r\n",
+			"/":           "=> docs/\n=> notes.txt\n",
+			"/docs/":      "=> a.gmi\n",
+			"/page.gmi":   "# Page\n",
+			"/notes.txt":  "line one\r\nline two",
+			"/with%20gap": "spaced",
+		}
+		return line, answers[strings.TrimRight(line, "\r\n")]
+	})
+	var tests = []struct {
+		name string
+		addr string // %s is the host
+		req  string
+		body string
+	}{
+		{"finger users", "finger://%s", "\r\n", "```finger\nUsers on: ann\n```\n"},
+		{"finger path", "finger://%s/ann", "ann\r\n", "```finger ann\nLogin: ann\nPlan: gardening\n```\n"},
+		{"finger userinfo", "finger://ann@%s", "ann\r\n", "```finger ann\nLogin: ann\nPlan: gardening\n```\n"},
+		{"finger userinfo wins", "finger://ann@%s/bob", "ann\r\n", "```finger ann\nLogin: ann\nPlan: gardening\n```\n"},
+		{"nex root", "nex://%s", "/\r\n", "=> docs/\n=> notes.txt\n"},
+		{"nex directory", "nex://%s/docs/", "/docs/\r\n", "=> a.gmi\n"},
+		{"nex gemtext", "nex://%s/page.gmi", "/page.gmi\r\n", "# Page\n"},
+		{"nex text", "nex://%s/notes.txt", "/notes.txt\r\n", "```notes.txt\nline one\nline two\n```\n"},
+		{"nex escaped", "nex://%s/with%20gap", "/with%20gap\r\n", "```with gap\nspaced\n```\n"},
+	}
+	for _, tt := range tests {
+		var before = len(srv.requests())
+		u, err := url.Parse(strings.Replace(tt.addr, "%s", srv.addr, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ctrl = NewControl(context.Background())
+		rdr, err := ctrl.Dial(u, nil)
+		if err != nil {
+			t.Errorf("%s: Dial, %v", tt.name, err)
+			ctrl.Close()
+			continue
+		}
+		body, _ := io.ReadAll(rdr)
+		ctrl.Close()
+		if ctrl.Meta() != "text/gemini" || string(body) != tt.body {
+			t.Errorf("%s: response %q %q, want text/gemini %q", tt.name, ctrl.Meta(), body, tt.body)
+		}
+		if reqs := srv.requests()[before:]; len(reqs) != 1 || reqs[0] != tt.req {
+			t.Errorf("%s: requests %q, want %q", tt.name, reqs, tt.req)
+		}
+	}
+}
+
+// the canceled context stops the dial
+func TestPlainCanceled(t *testing.T) {
+	var srv = servePlain(t, func(r *bufio.Reader) (string, string) { return "", "" })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	u, _ := url.Parse("finger://" + srv.addr + "/ann")
+	var ctrl = NewControl(ctx)
+	defer ctrl.Close()
+	if _, err := ctrl.Dial(u, nil); err == nil || !strings.Contains(err.Error(), "Failed to connect") {
+		t.Errorf("Dial error %v, want Failed to connect", err)
+	}
+}
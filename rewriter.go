@@ -1,26 +1,129 @@
 package gmi
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+	"strings"
 
 	"golang.org/x/sync/errgroup"
 )
 
-// skeleton rule to demonstrate GEMtext link lines.
-func rewriteLink(n Node) string {
-	return fmt.Sprintf("\n[+] %s", n.String())
+// number of workers which drain the channel of each rule
+const poolSize = 4
+
+// skeleton rule to demonstrate GEMtext link lines,
+// relative links are resolved against the page address.
+func rewriteLink(ctx context.Context, n Node) (string, error) {
+	var lnk, ok = n.(*LinkNode)
+	if !ok || lnk.URL == nil {
+		return fmt.Sprintf("\n[+] %s", n.String()), nil
+	}
+	var base = BaseURL(ctx)
+	if base == nil || lnk.URL.IsAbs() {
+		return fmt.Sprintf("\n[+] %s", n.String()), nil
+	}
+	var lu = base.ResolveReference(lnk.URL)
+	return fmt.Sprintf("\n[+] %s %s", lu, lnk.Friendly), nil
+}
+
+// skeleton rule for the input lines (Spartan), like the links
+// with the marker that the reader asks for the text.
+func rewritePrompt(ctx context.Context, n Node) (string, error) {
+	var pr, ok = n.(*PromptNode)
+	if !ok || pr.URL == nil {
+		return fmt.Sprintf("\n[?] %s", n.String()), nil
+	}
+	var base = BaseURL(ctx)
+	if base == nil || pr.URL.IsAbs() {
+		return fmt.Sprintf("\n[?] %s", n.String()), nil
+	}
+	var lu = base.ResolveReference(pr.URL)
+	return fmt.Sprintf("\n[?] %s %s", lu, pr.Friendly), nil
 }
 
 // A default rule for GEMtext plain text lines.
-func vanilla(n Node) string {
-	return fmt.Sprintf("\n%s", n.String())
+func vanilla(n Node) (string, error) {
+	return fmt.Sprintf("\n%s", n.String()), nil
+}
+
+// wrap the rule which has no use for the context
+func adapt(f func(Node) (string, error)) func(context.Context, Node) (string, error) {
+	return func(_ context.Context, n Node) (string, error) {
+		return f(n)
+	}
+}
+
+// job pairs the node with its index from the tree walk
+type job struct {
+	ctx   context.Context
+	index int
+	node  Node
+}
+
+// use a wrapper to handle (enforce) the channel to the func,
+// results are stored at the node index to keep the page order
+func spawn(g *errgroup.Group, size int, ch <-chan job, f func(context.Context, Node) (string, error), out []string, errs []error) {
+	for w := 0; w < size; w++ {
+		g.Go(func() error {
+			for jb := range ch {
+				row, err := f(jb.ctx, jb.node)
+				if err != nil {
+					// keep going, Retrieve aggregates the failures
+					errs[jb.index] = fmt.Errorf("Rewriter failed on node %d, %w", jb.index, err)
+					continue
+				}
+				out[jb.index] = row
+			}
+			return nil
+		})
+	}
+}
+
+// RewriteErrors are the rule failures collected by one Retrieve
+type RewriteErrors []error
+
+func (e RewriteErrors) Error() string {
+	var msg = make([]string, len(e))
+	for i, err := range e {
+		msg[i] = err.Error()
+	}
+	return strings.Join(msg, "; ")
+}
+
+// details of the page which rules can read from the context
+type pageScope struct {
+	base *url.URL
+	meta string
+}
+
+const (
+	pageScopeKey = "RewritePageScope"
+	nodeIndexKey = "RewriteNodeIndex"
+)
+
+// BaseURL is the page address (after redirects) given to rules,
+// nil when the body was not fetched by Dial.
+func BaseURL(ctx context.Context) *url.URL {
+	if ps, ok := ctx.Value(pageScopeKey).(pageScope); ok {
+		return ps.base
+	}
+	return nil
+}
+
+// Meta is the response header meta field (MIME type) given to rules
+func Meta(ctx context.Context) string {
+	if ps, ok := ctx.Value(pageScopeKey).(pageScope); ok {
+		return ps.meta
+	}
+	return ""
 }
 
-// use a wrapper to handle (enforce) the channels to/from the func
-func spawn(ch <-chan Node, f func(Node) string, out chan<- string, g *errgroup.Group) {
-	g.Go(func() error {
-		var node = <-ch
-		out <- f(node)
-		return nil
-	})
+// NodeIndex is the position of the node in the tree walk
+// (-1 when the context is not from Retrieve).
+func NodeIndex(ctx context.Context) int {
+	if i, ok := ctx.Value(nodeIndexKey).(int); ok {
+		return i
+	}
+	return -1
 }
@@ -0,0 +1,281 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// key algorithms of NewCertificate
+const (
+	ECDSA   = "ecdsa" // P-256, the widest client support
+	Ed25519 = "ed25519"
+)
+
+// CertOptions describe the self-signed server certificate
+type CertOptions struct {
+	Hosts     []string      // DNS names or IP addresses, the first is the common name
+	Algorithm string        // ECDSA (default) or Ed25519
+	Validity  time.Duration // defaults to DefaultValidity
+	// Key is signed instead of a new key (the Algorithm is not used)
+	Key crypto.Signer
+	// KeepKey makes Rotate re-sign the key of the old pair, the pins
+	// of the clients (which pin the key) stay valid
+	KeepKey bool
+}
+
+// capsule certificates are pinned by clients (TOFU), a long validity
+// avoids breaking the pins when the certificate expires
+const DefaultValidity = 20 * 365 * 24 * time.Hour
+
+var ErrCertExists = errors.New("Certificate file exists")
+
+// NewCertificate generates the self-signed certificate and private key
+// (both PEM encoded), with Key set the key is signed instead
+func NewCertificate(opts CertOptions) (certPEM []byte, keyPEM []byte, err error) {
+	if len(opts.Hosts) == 0 || strings.TrimSpace(opts.Hosts[0]) == "" {
+		return nil, nil, fmt.Errorf("Certificate requires a host name")
+	}
+	var (
+		pub  crypto.PublicKey
+		priv crypto.Signer
+	)
+	switch alg := strings.ToLower(opts.Algorithm); {
+	case opts.Key != nil:
+		pub, priv = opts.Key.Public(), opts.Key
+	case alg == "" || alg == ECDSA:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		pub, priv = key.Public(), key
+	case alg == Ed25519:
+		pk, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		pub, priv = pk, key
+	default:
+		return nil, nil, fmt.Errorf("Unsupported key algorithm, %s", opts.Algorithm)
+	}
+	var validity = opts.Validity
+	if validity <= 0 {
+		validity = DefaultValidity
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	var now = time.Now()
+	var tmpl = &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: strings.TrimSpace(opts.Hosts[0])},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range opts.Hosts {
+		host = strings.TrimSpace(host)
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else if host != "" {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Certificate create, %w", err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Certificate key, %w", err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+	return certPEM, keyPEM, nil
+}
+
+// WriteCertificate generates the pair into the files, the key is only
+// readable by the owner; existing files are not replaced (see Rotate)
+func WriteCertificate(certFile string, keyFile string, opts CertOptions) error {
+	for _, name := range []string{certFile, keyFile} {
+		if _, err := os.Stat(name); err == nil {
+			return fmt.Errorf("%w, %s", ErrCertExists, name)
+		}
+	}
+	certPEM, keyPEM, err := NewCertificate(opts)
+	if err != nil {
+		return err
+	}
+	return writePair(certFile, certPEM, keyFile, keyPEM)
+}
+
+// replaced by the tests to fail the write
+var writeFile = os.WriteFile
+
+func writePair(certFile string, certPEM []byte, keyFile string, keyPEM []byte) error {
+	for _, name := range []string{certFile, keyFile} {
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			return err
+		}
+	}
+	if err := writeFile(keyFile, keyPEM, 0600); err != nil {
+		return fmt.Errorf("Certificate key file, %w", err)
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(keyFile, 0600); err != nil {
+		return err
+	}
+	if err := writeFile(certFile, certPEM, 0644); err != nil {
+		return fmt.Errorf("Certificate file, %w", err)
+	}
+	return nil
+}
+
+// Rotate replaces the pair with a new certificate (for the names of the
+// old one when Hosts is empty). The old files are kept with a .old suffix,
+// or a timestamped one when a .old pair exists already. Clients pinned the
+// old key (TOFU) and will warn about or refuse a new one, KeepKey signs the
+// old key again so the pins stay valid; otherwise the warning is logged
+// with the fingerprints to publish for the visitors before the pair is
+// replaced.
+func Rotate(certFile string, keyFile string, opts CertOptions) error {
+	var previous string
+	old, err := LoadCertificate(certFile, keyFile)
+	if err == nil {
+		previous = Fingerprint(old.Leaf)
+		if len(opts.Hosts) == 0 {
+			// keep the names of the old certificate
+			opts.Hosts = append(opts.Hosts, old.Leaf.DNSNames...)
+			for _, ip := range old.Leaf.IPAddresses {
+				opts.Hosts = append(opts.Hosts, ip.String())
+			}
+		}
+		if opts.KeepKey {
+			signer, ok := old.PrivateKey.(crypto.Signer)
+			if !ok {
+				return fmt.Errorf("Certificate key cannot sign, %T", old.PrivateKey)
+			}
+			opts.Key = signer
+		}
+		if time.Until(old.Leaf.NotAfter) > 30*24*time.Hour {
+			log.Printf("INFO rotating a certificate valid until %s", old.Leaf.NotAfter.Format("2006-01-02"))
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	} else if opts.KeepKey {
+		return fmt.Errorf("Certificate key to keep, %w", err)
+	}
+	// the live pair stays in place until the new one exists
+	certPEM, keyPEM, err := NewCertificate(opts)
+	if err != nil {
+		return err
+	}
+	if previous == "" {
+		return writePair(certFile, certPEM, keyFile, keyPEM)
+	}
+	block, _ := pem.Decode(certPEM)
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("Certificate parse, %w", err)
+	}
+	if opts.KeepKey {
+		log.Printf("INFO rotating the certificate with the same key, the pins of the clients (TOFU) stay valid")
+	} else {
+		log.Printf("INFO rotating the certificate, clients which trusted the old certificate (TOFU) will report a changed identity")
+	}
+	log.Printf("INFO old fingerprint %s", previous)
+	log.Printf("INFO new fingerprint %s", Fingerprint(leaf))
+
+	var suffix = backupSuffix(certFile, keyFile)
+	for _, name := range []string{certFile, keyFile} {
+		if err = os.Rename(name, name+suffix); err != nil {
+			restore(certFile, keyFile, suffix)
+			return fmt.Errorf("Certificate backup, %w", err)
+		}
+	}
+	if err = writePair(certFile, certPEM, keyFile, keyPEM); err != nil {
+		restore(certFile, keyFile, suffix)
+		return err
+	}
+	return nil
+}
+
+// .old unless an earlier backup has the name
+func backupSuffix(certFile string, keyFile string) string {
+	for _, name := range []string{certFile, keyFile} {
+		if _, err := os.Lstat(name + ".old"); err == nil {
+			return ".old." + time.Now().Format("20060102150405")
+		}
+	}
+	return ".old"
+}
+
+// put the backup pair back after a failed rotation
+func restore(certFile string, keyFile string, suffix string) {
+	for _, name := range []string{certFile, keyFile} {
+		if _, err := os.Stat(name + suffix); err != nil {
+			continue
+		}
+		if err := os.Rename(name+suffix, name); err != nil {
+			log.Printf("ERROR certificate restore %s, %v", name, err)
+		}
+	}
+}
+
+// LoadCertificate reads the PEM pair with the parsed leaf certificate
+func LoadCertificate(certFile string, keyFile string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return cert, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return cert, err
+	}
+	return cert, nil
+}
+
+// EnsureCertificate loads the pair, or generates it for the host when the
+// files are missing (first start of a capsule)
+func EnsureCertificate(certFile string, keyFile string, host string) (tls.Certificate, error) {
+	cert, err := LoadCertificate(certFile, keyFile)
+	if err == nil {
+		if time.Now().After(cert.Leaf.NotAfter) {
+			log.Printf("INFO certificate expired %s, rotate it", cert.Leaf.NotAfter.Format("2006-01-02"))
+		}
+		return cert, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return cert, err
+	}
+	log.Printf("INFO generating certificate for %s", host)
+	if err = WriteCertificate(certFile, keyFile, CertOptions{Hosts: []string{host}}); err != nil {
+		return cert, err
+	}
+	return LoadCertificate(certFile, keyFile)
+}
+
+// Fingerprint is the SHA-256 of the certificate (hex)
+func Fingerprint(cert *x509.Certificate) string {
+	var sum = sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
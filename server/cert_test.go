@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// certificate pair of example.org in a temp directory
+func testPair(t *testing.T) (string, string) {
+	t.Helper()
+	var (
+		dir      = t.TempDir()
+		certFile = filepath.Join(dir, "cert.pem")
+		keyFile  = filepath.Join(dir, "key.pem")
+	)
+	if err := WriteCertificate(certFile, keyFile, CertOptions{Hosts: []string{"example.org"}}); err != nil {
+		t.Fatalf("WriteCertificate, %v", err)
+	}
+	return certFile, keyFile
+}
+
+func readFile(t *testing.T, name string) []byte {
+	t.Helper()
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("read %s, %v", name, err)
+	}
+	return buf
+}
+
+func publicKey(t *testing.T, certFile string, keyFile string) []byte {
+	t.Helper()
+	cert, err := LoadCertificate(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("LoadCertificate, %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(cert.Leaf.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestRotate(t *testing.T) {
+	var tests = []struct {
+		name    string
+		keep    bool
+		sameKey bool
+	}{
+		{"new key", false, false},
+		{"keep key", true, true},
+	}
+	for _, tt := range tests {
+		certFile, keyFile := testPair(t)
+		var (
+			oldKey  = publicKey(t, certFile, keyFile)
+			oldCert = readFile(t, certFile)
+		)
+		if err := Rotate(certFile, keyFile, CertOptions{KeepKey: tt.keep}); err != nil {
+			t.Fatalf("%s: Rotate, %v", tt.name, err)
+		}
+		if bytes.Equal(readFile(t, certFile), oldCert) {
+			t.Errorf("%s: certificate was not replaced", tt.name)
+		}
+		if same := bytes.Equal(publicKey(t, certFile, keyFile), oldKey); same != tt.sameKey {
+			t.Errorf("%s: same key %v, want %v", tt.name, same, tt.sameKey)
+		}
+		if !bytes.Equal(readFile(t, certFile+".old"), oldCert) {
+			t.Errorf("%s: .old is not the previous certificate", tt.name)
+		}
+		cert, _ := LoadCertificate(certFile, keyFile)
+		if len(cert.Leaf.DNSNames) != 1 || cert.Leaf.DNSNames[0] != "example.org" {
+			t.Errorf("%s: names %v, want the names of the old certificate", tt.name, cert.Leaf.DNSNames)
+		}
+	}
+}
+
+// an earlier backup is not overwritten
+func TestRotateBackup(t *testing.T) {
+	certFile, keyFile := testPair(t)
+	if err := Rotate(certFile, keyFile, CertOptions{}); err != nil {
+		t.Fatalf("Rotate, %v", err)
+	}
+	var (
+		first = readFile(t, certFile+".old")
+		live  = readFile(t, certFile)
+	)
+	if err := Rotate(certFile, keyFile, CertOptions{}); err != nil {
+		t.Fatalf("second Rotate, %v", err)
+	}
+	if !bytes.Equal(readFile(t, certFile+".old"), first) {
+		t.Errorf("the first .old pair was overwritten")
+	}
+	backups, _ := filepath.Glob(certFile + ".old.*")
+	if len(backups) != 1 || !bytes.Equal(readFile(t, backups[0]), live) {
+		t.Errorf("timestamped backups %v, want the previous live certificate", backups)
+	}
+}
+
+func TestRotateFailure(t *testing.T) {
+	var errDisk = errors.New("disk full")
+	var tests = []struct {
+		name  string
+		opts  CertOptions
+		write func(string, []byte, os.FileMode) error
+	}{
+		{"bad algorithm", CertOptions{Algorithm: "rsa"}, os.WriteFile},
+		{"key written, cert fails", CertOptions{}, func(name string, buf []byte, mode os.FileMode) error {
+			if strings.HasSuffix(name, "cert.pem") {
+				return errDisk
+			}
+			return os.WriteFile(name, buf, mode)
+		}},
+		{"key fails", CertOptions{}, func(string, []byte, os.FileMode) error {
+			return errDisk
+		}},
+	}
+	defer func() { writeFile = os.WriteFile }()
+	for _, tt := range tests {
+		certFile, keyFile := testPair(t)
+		var (
+			cert = readFile(t, certFile)
+			key  = readFile(t, keyFile)
+		)
+		writeFile = tt.write
+		if err := Rotate(certFile, keyFile, tt.opts); err == nil {
+			t.Errorf("%s: Rotate succeeded", tt.name)
+		}
+		writeFile = os.WriteFile
+		// the live pair is restored
+		if !bytes.Equal(readFile(t, certFile), cert) || !bytes.Equal(readFile(t, keyFile), key) {
+			t.Errorf("%s: live pair changed", tt.name)
+		}
+		if _, err := os.Stat(certFile + ".old"); err == nil {
+			t.Errorf("%s: .old backup left behind", tt.name)
+		}
+	}
+}
+
+func TestRotateKeepKeyMissing(t *testing.T) {
+	var dir = t.TempDir()
+	err := Rotate(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), CertOptions{Hosts: []string{"example.org"}, KeepKey: true})
+	if err == nil {
+		t.Errorf("Rotate kept a key which does not exist")
+	}
+}
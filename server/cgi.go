@@ -0,0 +1,242 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CGI runs the executables of the directory, e.g. with Prefix
+// "/cgi-bin" the request gemini://host/cgi-bin/guestbook/sign?hi runs
+// Dir/guestbook with PATH_INFO "/sign" and QUERY_STRING "hi". The first
+// line written by the script is the response header (status and meta),
+// the rest is streamed as the body.
+type CGI struct {
+	Dir     string        // directory of the scripts
+	Prefix  string        // URL path where the directory is mounted
+	Timeout time.Duration // defaults to 10 seconds
+	Env     []string      // extra variables (KEY=value)
+}
+
+const defaultCGITimeout = 10 * time.Second
+
+func (c *CGI) ServeGemini(w ResponseWriter, r *Request) {
+	script, pathInfo, ok := c.lookup(r.URL.Path)
+	if !ok {
+		NotFound(w, r)
+		return
+	}
+	var timeout = c.Timeout
+	if timeout <= 0 {
+		timeout = defaultCGITimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	// absolute, the relative path would be resolved again from cmd.Dir
+	bin, err := filepath.Abs(filepath.Join(c.Dir, filepath.FromSlash(script)))
+	if err != nil {
+		log.Printf("ERROR cgi path %s, %v", script, err)
+		w.WriteHeader(StatusCGIError, "CGI error")
+		return
+	}
+	var cmd = exec.CommandContext(ctx, bin)
+	// children of the killed script can hold stdout and stderr open
+	cmd.WaitDelay = time.Second
+	cmd.Dir = filepath.Dir(bin)
+	cmd.Env = append(c.environ(r, script, pathInfo), c.Env...)
+	cmd.Stderr = &logWriter{prefix: "INFO cgi " + script + ", "}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Printf("ERROR cgi pipe %s, %v", script, err)
+		w.WriteHeader(StatusCGIError, "CGI error")
+		return
+	}
+	if err = cmd.Start(); err != nil {
+		log.Printf("ERROR cgi start %s, %v", script, err)
+		w.WriteHeader(StatusCGIError, "CGI error")
+		return
+	}
+	defer func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("INFO cgi exit %s, %v", script, err)
+		}
+	}()
+
+	var rdr = bufio.NewReaderSize(stdout, maxMeta+8)
+	status, meta, err := cgiHeader(rdr)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = ctx.Err()
+		}
+		log.Printf("ERROR cgi header %s, %v", script, err)
+		w.WriteHeader(StatusCGIError, "CGI error")
+		io.Copy(io.Discard, rdr)
+		return
+	}
+	w.WriteHeader(status, meta)
+	if status/10 != 2 {
+		io.Copy(io.Discard, rdr)
+		return
+	}
+	if _, err = io.Copy(w, rdr); err != nil {
+		log.Printf("INFO cgi body %s, %v", script, err)
+		cancel()
+		io.Copy(io.Discard, rdr)
+	}
+}
+
+// lookup walks the path below the prefix to the first executable file,
+// the remainder is the path info
+func (c *CGI) lookup(urlPath string) (script string, pathInfo string, ok bool) {
+	var prefix = "/" + strings.Trim(c.Prefix, "/")
+	var rel = path.Clean("/" + urlPath)
+	if prefix != "/" {
+		if rel != prefix && !strings.HasPrefix(rel, prefix+"/") {
+			return "", "", false
+		}
+		rel = strings.TrimPrefix(rel, prefix)
+	}
+	var segs = strings.Split(strings.Trim(rel, "/"), "/")
+	for i := range segs {
+		if strings.HasPrefix(segs[i], ".") || segs[i] == "" {
+			return "", "", false
+		}
+		var name = strings.Join(segs[:i+1], "/")
+		fi, err := os.Stat(filepath.Join(c.Dir, filepath.FromSlash(name)))
+		if err != nil {
+			return "", "", false
+		}
+		if fi.IsDir() {
+			continue
+		}
+		if fi.Mode()&0111 == 0 {
+			return "", "", false
+		}
+		if i+1 < len(segs) {
+			pathInfo = "/" + strings.Join(segs[i+1:], "/")
+		}
+		return name, pathInfo, true
+	}
+	return "", "", false
+}
+
+// the variables of the Gemini CGI convention (CGI/1.1 names with the
+// TLS_ details of the client certificate)
+func (c *CGI) environ(r *Request, script string, pathInfo string) []string {
+	var (
+		host, port = r.URL.Hostname(), r.URL.Port()
+		prefix     = strings.TrimSuffix("/"+strings.Trim(c.Prefix, "/"), "/")
+		remote     = clientIP(r.RemoteAddr)
+	)
+	if port == "" {
+		port = "1965"
+	}
+	var env = []string{
+		"GATEWAY_INTERFACE=CGI/1.1",
+		"SERVER_PROTOCOL=GEMINI",
+		"SERVER_SOFTWARE=gmi",
+		"SERVER_NAME=" + host,
+		"SERVER_PORT=" + port,
+		"GEMINI_URL=" + r.URL.String(),
+		"GEMINI_URL_PATH=" + r.URL.Path,
+		"SCRIPT_NAME=" + prefix + "/" + script,
+		"PATH_INFO=" + pathInfo,
+		"QUERY_STRING=" + r.URL.RawQuery,
+		"REMOTE_ADDR=" + remote,
+		"REMOTE_HOST=" + remote,
+		"PATH=" + os.Getenv("PATH"),
+	}
+	if pathInfo != "" {
+		env = append(env, "PATH_TRANSLATED="+filepath.Join(c.Dir, filepath.FromSlash(pathInfo)))
+	}
+	if r.TLS != nil {
+		env = append(env,
+			"TLS_VERSION="+tlsVersion(r.TLS.Version),
+			"TLS_CIPHER="+tls.CipherSuiteName(r.TLS.CipherSuite),
+		)
+		if r.TLS.ServerName != "" {
+			env = append(env, "TLS_SERVER_NAME="+r.TLS.ServerName)
+		}
+	}
+	if cert := r.Certificate; cert != nil {
+		var sum = sha256.Sum256(cert.Raw)
+		env = append(env,
+			"AUTH_TYPE=Certificate",
+			"REMOTE_USER="+cert.Subject.CommonName,
+			"TLS_CLIENT_HASH=SHA256:"+strings.ToUpper(hex.EncodeToString(sum[:])),
+			"TLS_CLIENT_SUBJECT="+cert.Subject.String(),
+			"TLS_CLIENT_ISSUER="+cert.Issuer.String(),
+			"TLS_CLIENT_SERIAL_NUMBER="+cert.SerialNumber.String(),
+			"TLS_CLIENT_NOT_BEFORE="+cert.NotBefore.UTC().Format(time.RFC3339),
+			"TLS_CLIENT_NOT_AFTER="+cert.NotAfter.UTC().Format(time.RFC3339),
+		)
+	}
+	return env
+}
+
+// first line of the script output, <STATUS><SPACE><META><CR><LF>
+func cgiHeader(rdr *bufio.Reader) (int, string, error) {
+	row, err := rdr.ReadString('\n')
+	if err != nil {
+		return 0, "", err
+	}
+	row = strings.TrimRight(row, "\r\n")
+	var code, meta = row, ""
+	if sp := strings.IndexAny(row, " \t"); sp >= 0 {
+		code, meta = row[:sp], strings.TrimSpace(row[sp+1:])
+	}
+	status, err := strconv.Atoi(code)
+	if err != nil || len(code) != 2 || status < 10 || status > 69 {
+		return 0, "", errors.New("CGI header status is malformed")
+	}
+	if len(meta) > maxMeta {
+		return 0, "", errors.New("CGI header meta exceeds 1024 bytes")
+	}
+	if status/10 == 2 && meta == "" {
+		meta = "text/gemini"
+	}
+	return status, meta, nil
+}
+
+func tlsVersion(v uint16) string {
+	switch v {
+	case tls.VersionTLS12:
+		return "TLSv1.2"
+	case tls.VersionTLS13:
+		return "TLSv1.3"
+	}
+	return "TLS"
+}
+
+// stderr of the script goes to the log one line at a time
+type logWriter struct {
+	prefix string
+	buf    []byte
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		lf := bytes.IndexByte(l.buf, '\n')
+		if lf < 0 {
+			break
+		}
+		log.Printf("%s%s", l.prefix, l.buf[:lf])
+		l.buf = l.buf[lf+1:]
+	}
+	return len(p), nil
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCGIHeader(t *testing.T) {
+	var tests = []struct {
+		row    string
+		status int
+		meta   string
+		ok     bool
+	}{
+		{"20 text/plain\r\n", 20, "text/plain", true},
+		{"20\n", 20, "text/gemini", true},
+		{"20 \r\n", 20, "text/gemini", true},
+		{"31\tgemini://elsewhere.example/\n", 31, "gemini://elsewhere.example/", true},
+		{"51 Not here  \r\n", 51, "Not here", true},
+		{"10 Name?\r\n", 10, "Name?", true},
+		{"2 text/gemini\r\n", 0, "", false},
+		{"200 OK\r\n", 0, "", false},
+		{"70 Unknown\r\n", 0, "", false},
+		{"Content-Type: text/html\r\n", 0, "", false},
+		{"20 " + strings.Repeat("m", 1025) + "\r\n", 0, "", false},
+		// the script ended before the line
+		{"20 text/gemini", 0, "", false},
+		{"", 0, "", false},
+	}
+	for _, tt := range tests {
+		status, meta, err := cgiHeader(bufio.NewReader(strings.NewReader(tt.row)))
+		if ok := err == nil; ok != tt.ok || status != tt.status || meta != tt.meta {
+			t.Errorf("%q: header %d %q (error %v), want %d %q", tt.row, status, meta, err, tt.status, tt.meta)
+		}
+	}
+}
+
+func TestCGIEnviron(t *testing.T) {
+	certPEM, _, err := NewCertificate(CertOptions{Hosts: []string{"visitor"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c = &CGI{Dir: "/srv/cgi", Prefix: "/cgi-bin/"}
+	var tests = []struct {
+		name string
+		req  *Request
+		want map[string]string
+	}{
+		{"anonymous", &Request{
+			URL:        mustURL(t, "gemini://capsule.example/cgi-bin/guestbook/sign/here?hi%20there"),
+			RemoteAddr: &net.TCPAddr{IP: net.ParseIP("192.0.2.7"), Port: 50000},
+		}, map[string]string{
+			"GATEWAY_INTERFACE": "CGI/1.1",
+			"SERVER_PROTOCOL":   "GEMINI",
+			"SERVER_NAME":       "capsule.example",
+			"SERVER_PORT":       "1965",
+			"GEMINI_URL":        "gemini://capsule.example/cgi-bin/guestbook/sign/here?hi%20there",
+			"GEMINI_URL_PATH":   "/cgi-bin/guestbook/sign/here",
+			"SCRIPT_NAME":       "/cgi-bin/guestbook",
+			"PATH_INFO":         "/sign/here",
+			"PATH_TRANSLATED":   filepath.Join("/srv/cgi", "sign", "here"),
+			"QUERY_STRING":      "hi%20there",
+			"REMOTE_ADDR":       "192.0.2.7",
+			"REMOTE_HOST":       "192.0.2.7",
+			"AUTH_TYPE":         "",
+			"TLS_CLIENT_HASH":   "",
+		}},
+		{"certificate", &Request{
+			URL:         mustURL(t, "gemini://capsule.example:1966/cgi-bin/guestbook"),
+			RemoteAddr:  &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 50000},
+			Certificate: cert,
+			TLS:         &tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256, ServerName: "capsule.example"},
+		}, map[string]string{
+			"SERVER_PORT":           "1966",
+			"PATH_INFO":             "",
+			"PATH_TRANSLATED":       "",
+			"REMOTE_ADDR":           "2001:db8::1",
+			"TLS_VERSION":           "TLSv1.3",
+			"TLS_CIPHER":            "TLS_AES_128_GCM_SHA256",
+			"TLS_SERVER_NAME":       "capsule.example",
+			"AUTH_TYPE":             "Certificate",
+			"REMOTE_USER":           "visitor",
+			"TLS_CLIENT_HASH":       "SHA256:" + strings.ToUpper(Fingerprint(cert)),
+			"TLS_CLIENT_NOT_BEFORE": cert.NotBefore.UTC().Format(time.RFC3339),
+			"TLS_CLIENT_NOT_AFTER":  cert.NotAfter.UTC().Format(time.RFC3339),
+		}},
+	}
+	for _, tt := range tests {
+		var (
+			script, pathInfo = "guestbook", ""
+			env              = make(map[string]string)
+		)
+		if rest := strings.TrimPrefix(tt.req.URL.Path, "/cgi-bin/guestbook"); rest != "" {
+			pathInfo = rest
+		}
+		for _, kv := range c.environ(tt.req, script, pathInfo) {
+			var eq = strings.IndexByte(kv, '=')
+			env[kv[:eq]] = kv[eq+1:]
+		}
+		for key, want := range tt.want {
+			if got := env[key]; got != want {
+				t.Errorf("%s: %s=%q, want %q", tt.name, key, got, want)
+			}
+		}
+	}
+}
+
+// scripts in a temp directory, the name maps to the shell body
+func cgiDir(t *testing.T, scripts map[string]string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the scripts need a shell")
+	}
+	var dir = t.TempDir()
+	for name, body := range scripts {
+		var file = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		var mode os.FileMode = 0755
+		if strings.HasSuffix(name, ".txt") {
+			mode = 0644
+		}
+		if err := os.WriteFile(file, []byte("#!/bin/sh\n"+body), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCGI(t *testing.T) {
+	var dir = cgiDir(t, map[string]string{
+		"hello":        `printf '20 text/plain\r\nhello %s %s' "$PATH_INFO" "$QUERY_STRING"`,
+		"tools/echo":   `printf '20\r\n%s' "$SCRIPT_NAME"`,
+		"moved":        `printf '31 /new\r\nbody is dropped'`,
+		"ask":          `printf '10 Name?\r\n'`,
+		"garbage":      `echo 'Content-Type: text/html'; echo; echo '<p>'`,
+		"silent":       `exit 0`,
+		"fails":        `echo 'to the log' >&2; exit 3`,
+		"readme.txt":   `printf '20\r\nnot executable'`,
+		".hidden":      `printf '20\r\nhidden'`,
+		"extra":        `printf '20\r\n%s' "$SITE"`,
+		"cwd":          `printf '20\r\n%s' "$(basename "$(pwd)")"`,
+		"tools/nested": `printf '20\r\nnested'`,
+	})
+	var c = &CGI{Dir: dir, Prefix: "/cgi-bin", Timeout: 500 * time.Millisecond, Env: []string{"SITE=capsule"}}
+	var tests = []struct {
+		path   string
+		status int
+		meta   string
+		body   string
+	}{
+		{"/cgi-bin/hello", StatusSuccess, "text/plain", "hello  "},
+		{"/cgi-bin/hello/a/b?x=1", StatusSuccess, "text/plain", "hello /a/b x=1"},
+		{"/cgi-bin/tools/echo", StatusSuccess, "text/gemini", "/cgi-bin/tools/echo"},
+		{"/cgi-bin/tools/nested", StatusSuccess, "text/gemini", "nested"},
+		{"/cgi-bin/moved", StatusPermanentRedirect, "/new", ""},
+		{"/cgi-bin/ask", StatusInput, "Name?", ""},
+		{"/cgi-bin/extra", StatusSuccess, "text/gemini", "capsule"},
+		{"/cgi-bin/cwd", StatusSuccess, "text/gemini", filepath.Base(dir)},
+		{"/cgi-bin/garbage", StatusCGIError, "CGI error", ""},
+		{"/cgi-bin/silent", StatusCGIError, "CGI error", ""},
+		{"/cgi-bin/fails", StatusCGIError, "CGI error", ""},
+		{"/cgi-bin/readme.txt", StatusNotFound, "Not found", ""},
+		{"/cgi-bin/.hidden", StatusNotFound, "Not found", ""},
+		{"/cgi-bin/tools", StatusNotFound, "Not found", ""},
+		{"/cgi-bin/missing", StatusNotFound, "Not found", ""},
+		{"/cgi-bin/../cgi-bin/hello", StatusSuccess, "text/plain", "hello  "},
+		{"/other/hello", StatusNotFound, "Not found", ""},
+		{"/cgi-binhello", StatusNotFound, "Not found", ""},
+	}
+	for _, tt := range tests {
+		var rec recorder
+		c.ServeGemini(&rec, &Request{URL: mustURL(t, "gemini://capsule.example"+tt.path)})
+		if rec.status != tt.status || rec.meta != tt.meta || rec.body.String() != tt.body {
+			t.Errorf("%s: %d %q %q, want %d %q %q", tt.path, rec.status, rec.meta, rec.body.String(), tt.status, tt.meta, tt.body)
+		}
+	}
+}
+
+// the child of the script which holds the output open does not
+// hold up the response
+func TestCGITimeout(t *testing.T) {
+	var dir = cgiDir(t, map[string]string{
+		"slow": `sleep 10; printf '20\r\nlate'`,
+		"body": `printf '20\r\nstart'; sleep 10`,
+	})
+	var c = &CGI{Dir: dir, Timeout: 200 * time.Millisecond}
+	var tests = []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/slow", StatusCGIError, ""},
+		{"/body", StatusSuccess, "start"},
+	}
+	for _, tt := range tests {
+		var (
+			rec   recorder
+			start = time.Now()
+		)
+		c.ServeGemini(&rec, &Request{URL: mustURL(t, "gemini://capsule.example"+tt.path)})
+		if took := time.Since(start); took > 5*time.Second {
+			t.Errorf("%s: response took %v", tt.path, took)
+		}
+		if rec.status != tt.status || rec.body.String() != tt.body {
+			t.Errorf("%s: %d %q, want %d %q", tt.path, rec.status, rec.body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+func mustURL(t *testing.T, addr string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(addr)
+	if err != nil {
+		t.Fatalf("Parse %s, %v", addr, err)
+	}
+	return u
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/shrmpy/gmi"
+)
+
+// FileServer serves the files of the tree, a directory is served by its
+// index.gmi (or a generated listing when there is none), e.g.
+//
+//	server.ListenAndServeTLS(":1965", "cert.pem", "key.pem",
+//		server.FileServer(os.DirFS("capsule")))
+//
+// Mounted on a Router pattern with a {path...} parameter the tree is
+// served below the mount, the parameter is the name inside the tree.
+func FileServer(root fs.FS) Handler {
+	return &fileHandler{root: root}
+}
+
+type fileHandler struct {
+	root fs.FS
+}
+
+func (f *fileHandler) ServeGemini(w ResponseWriter, r *Request) {
+	var name, ok = cleanPath(treePath(r))
+	if !ok {
+		NotFound(w, r)
+		return
+	}
+	info, err := fs.Stat(f.root, name)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("ERROR stat %s, %v", name, err)
+		}
+		NotFound(w, r)
+		return
+	}
+	if info.IsDir() {
+		// relative links of the index need the trailing slash
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			var target = *r.URL
+			target.Path += "/"
+			Redirect(w, r, target.String(), true)
+			return
+		}
+		var index = path.Join(name, "index.gmi")
+		if _, err = fs.Stat(f.root, index); err != nil {
+			f.listing(w, r, name)
+			return
+		}
+		name = index
+	}
+	f.serveFile(w, name)
+}
+
+func (f *fileHandler) serveFile(w ResponseWriter, name string) {
+	file, err := f.root.Open(name)
+	if err != nil {
+		log.Printf("ERROR open %s, %v", name, err)
+		w.WriteHeader(StatusTemporaryFailure, "File unavailable")
+		return
+	}
+	defer file.Close()
+	w.WriteHeader(StatusSuccess, MimeType(name))
+	if _, err = io.Copy(w, file); err != nil {
+		log.Printf("INFO copy %s, %v", name, err)
+	}
+}
+
+// path parameter of the route when mounted, otherwise the request path
+func treePath(r *Request) string {
+	if params, ok := r.Context().Value(routeParamsKey).(map[string]string); ok {
+		if p, ok := params["path"]; ok {
+			return p
+		}
+	}
+	return r.URL.Path
+}
+
+// generated index of the directory
+func (f *fileHandler) listing(w ResponseWriter, r *Request, dir string) {
+	entries, err := fs.ReadDir(f.root, dir)
+	if err != nil {
+		log.Printf("ERROR list %s, %v", dir, err)
+		NotFound(w, r)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	var doc = gmi.NewDocument().Heading(1, "Index of "+r.URL.Path).Blank()
+	if dir != "." {
+		doc.Link("../", "..")
+	}
+	for _, en := range entries {
+		var name = en.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if en.IsDir() {
+			name += "/"
+		}
+		doc.Link(relRef(name), name)
+	}
+	w.WriteHeader(StatusSuccess, "text/gemini")
+	if _, err = doc.WriteTo(w); err != nil {
+		log.Printf("INFO listing %s, %v", dir, err)
+	}
+}
+
+// cleanPath maps the URL path into the tree, hidden files and paths
+// which escape the root are refused
+func cleanPath(p string) (string, bool) {
+	var name = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" {
+		return ".", true
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return "", false
+		}
+	}
+	return name, fs.ValidPath(name)
+}
+
+// MimeType of the file from the extension, gemtext for .gmi/.gemini
+func MimeType(name string) string {
+	switch ext := strings.ToLower(path.Ext(name)); ext {
+	case ".gmi", ".gemini":
+		return "text/gemini"
+	case "":
+		return "application/octet-stream"
+	default:
+		if mt := mime.TypeByExtension(ext); mt != "" {
+			return mt
+		}
+	}
+	return "application/octet-stream"
+}
+
+// relative reference of a file name (a colon would read as a scheme)
+func relRef(name string) string {
+	var esc = strings.NewReplacer("%", "%25", " ", "%20", "?", "%3F", "#", "%23").Replace(name)
+	if strings.Contains(esc, ":") {
+		return "./" + esc
+	}
+	return esc
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+	"testing/fstest"
+)
+
+var capsule = fstest.MapFS{
+	"index.gmi":            {Data: []byte("# Home\n")},
+	"notes/index.gmi":      {Data: []byte("# Notes\n")},
+	"notes/first.gmi":      {Data: []byte("# First\n")},
+	"files/logo.png":       {Data: []byte("png")},
+	"files/a:b.txt":        {Data: []byte("colon")},
+	"files/two words.txt":  {Data: []byte("space")},
+	"files/sub/readme.txt": {Data: []byte("sub")},
+	"files/.secret":        {Data: []byte("hidden")},
+	".git/config":          {Data: []byte("hidden")},
+}
+
+func TestFileServer(t *testing.T) {
+	var (
+		h = FileServer(capsule)
+		// the system mime tables may add to the charset
+		txt = MimeType("two words.txt")
+	)
+	var tests = []struct {
+		path   string
+		status int
+		meta   string
+		body   string
+	}{
+		{"/", StatusSuccess, "text/gemini", "# Home\n"},
+		{"", StatusPermanentRedirect, "gemini://capsule.example/", ""},
+		{"/index.gmi", StatusSuccess, "text/gemini", "# Home\n"},
+		{"/notes/", StatusSuccess, "text/gemini", "# Notes\n"},
+		{"/notes", StatusPermanentRedirect, "gemini://capsule.example/notes/", ""},
+		{"/notes/first.gmi", StatusSuccess, "text/gemini", "# First\n"},
+		{"/files/logo.png", StatusSuccess, "image/png", "png"},
+		{"/files/two%20words.txt", StatusSuccess, txt, "space"},
+		{"/files/", StatusSuccess, "text/gemini", "# Index of /files/\n\n=> ../ ..\n=> ./a:b.txt a:b.txt\n=> logo.png logo.png\n=> sub/ sub/\n=> two%20words.txt two words.txt\n"},
+		{"/missing.gmi", StatusNotFound, "Not found", ""},
+		// no way out of the tree, and nothing hidden
+		{"/../index.gmi", StatusSuccess, "text/gemini", "# Home\n"},
+		{"/notes/../../../etc/passwd", StatusNotFound, "Not found", ""},
+		{"/%2e%2e/%2e%2e/etc/passwd", StatusNotFound, "Not found", ""},
+		{"/files/.secret", StatusNotFound, "Not found", ""},
+		{"/.git/config", StatusNotFound, "Not found", ""},
+		{"/files/sub/../.secret", StatusNotFound, "Not found", ""},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse("gemini://capsule.example" + tt.path)
+		if err != nil {
+			t.Fatalf("Parse %s, %v", tt.path, err)
+		}
+		var rec recorder
+		h.ServeGemini(&rec, &Request{URL: u})
+		if rec.status != tt.status || rec.meta != tt.meta || rec.body.String() != tt.body {
+			t.Errorf("%q: %d %q %q, want %d %q %q", tt.path, rec.status, rec.meta, rec.body.String(), tt.status, tt.meta, tt.body)
+		}
+	}
+}
+
+// mounted below a route the parameter is the name in the tree
+func TestFileServerMount(t *testing.T) {
+	var rt = NewRouter()
+	rt.Handle("/static/{path...}", FileServer(capsule))
+	var tests = []struct {
+		path   string
+		status int
+		meta   string
+	}{
+		{"/static/", StatusSuccess, "text/gemini"},
+		{"/static", StatusPermanentRedirect, "gemini://capsule.example/static/"},
+		{"/static/files/logo.png", StatusSuccess, "image/png"},
+		{"/static/../index.gmi", StatusSuccess, "text/gemini"},
+		{"/static/%2e%2e/%2e%2e/etc/passwd", StatusNotFound, "Not found"},
+		{"/static/.git/config", StatusNotFound, "Not found"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse("gemini://capsule.example" + tt.path)
+		if err != nil {
+			t.Fatalf("Parse %s, %v", tt.path, err)
+		}
+		var rec recorder
+		rt.ServeGemini(&rec, &Request{URL: u})
+		if rec.status != tt.status || rec.meta != tt.meta {
+			t.Errorf("%q: header %d %q, want %d %q", tt.path, rec.status, rec.meta, tt.status, tt.meta)
+		}
+	}
+}
+
+func TestMimeType(t *testing.T) {
+	var tests = []struct {
+		name string
+		want string
+	}{
+		{"index.gmi", "text/gemini"},
+		{"PAGE.GEMINI", "text/gemini"},
+		{"logo.png", "image/png"},
+		{"README", "application/octet-stream"},
+		{"data.unknownext", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		if got := MimeType(tt.name); got != tt.want {
+			t.Errorf("%s: mime %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
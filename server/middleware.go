@@ -0,0 +1,182 @@
+package server
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Input prompts for the query (status 10), the handler receives the
+// unescaped answer (percent-encoding only, a + stays a plus)
+func Input(prompt string, f func(w ResponseWriter, r *Request, input string)) Handler {
+	return input(StatusInput, prompt, f)
+}
+
+// SensitiveInput prompts like Input without echo of the answer (status 11)
+func SensitiveInput(prompt string, f func(w ResponseWriter, r *Request, input string)) Handler {
+	return input(StatusSensitiveInput, prompt, f)
+}
+
+func input(status int, prompt string, f func(ResponseWriter, *Request, string)) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.RawQuery == "" {
+			w.WriteHeader(status, prompt)
+			return
+		}
+		answer, err := url.PathUnescape(r.URL.RawQuery)
+		if err != nil {
+			w.WriteHeader(StatusBadRequest, "Malformed query")
+			return
+		}
+		f(w, r, answer)
+	})
+}
+
+// RequireCertificate answers 60 without a client certificate and 62
+// when it is outside of its validity period
+func RequireCertificate(h Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.Certificate == nil {
+			w.WriteHeader(StatusCertificateRequired, "Client certificate required")
+			return
+		}
+		var now = time.Now()
+		if now.Before(r.Certificate.NotBefore) || now.After(r.Certificate.NotAfter) {
+			w.WriteHeader(StatusCertificateNotValid, "Client certificate is not valid")
+			return
+		}
+		h.ServeGemini(w, r)
+	})
+}
+
+// Logger writes the access log with the status of the response
+func Logger(h Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		var (
+			start = time.Now()
+			sw    = &statusWriter{ResponseWriter: w}
+		)
+		h.ServeGemini(sw, r)
+		if sw.status == 0 {
+			sw.status = StatusSuccess
+		}
+		log.Printf("INFO %s %d %s %v", r.RemoteAddr, sw.status, r.URL, time.Since(start))
+	})
+}
+
+// Recover turns a panic of the handler into status 40
+func Recover(h Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		var sw = &statusWriter{ResponseWriter: w}
+		defer func() {
+			if v := recover(); v != nil {
+				log.Printf("ERROR handler panic %s, %v", r.URL, v)
+				if sw.status == 0 {
+					sw.WriteHeader(StatusTemporaryFailure, "Internal error")
+				}
+			}
+		}()
+		h.ServeGemini(sw, r)
+	})
+}
+
+// statusWriter records the status which the handler sent
+type statusWriter struct {
+	ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int, meta string) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status, meta)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = StatusSuccess
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+// RateLimit allows each client address the count of requests per
+// interval (token bucket), others are answered with 44 and the seconds
+// to wait
+func RateLimit(count int, per time.Duration) Middleware {
+	var lim = &limiter{
+		rate:    float64(count) / per.Seconds(),
+		burst:   float64(count),
+		buckets: make(map[string]*bucket),
+	}
+	return func(h Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			if wait := lim.take(clientIP(r.RemoteAddr)); wait > 0 {
+				w.WriteHeader(StatusSlowDown, strconv.Itoa(wait))
+				return
+			}
+			h.ServeGemini(w, r)
+		})
+	}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type limiter struct {
+	sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// take uses a token, the result is the seconds until one is available
+// (zero when the request is allowed)
+func (l *limiter) take(key string) int {
+	l.Lock()
+	defer l.Unlock()
+	var now = time.Now()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return int(math.Ceil((1 - b.tokens) / l.rate))
+}
+
+// drop the buckets which are full again (idle clients)
+func (l *limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func clientIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestInput(t *testing.T) {
+	var h = Input("Name?", func(w ResponseWriter, r *Request, input string) {
+		w.WriteHeader(StatusSuccess, input)
+	})
+	var tests = []struct {
+		addr   string
+		status int
+		meta   string
+	}{
+		{"gemini://capsule.example/ask", StatusInput, "Name?"},
+		{"gemini://capsule.example/ask?a+b", StatusSuccess, "a+b"},
+		{"gemini://capsule.example/ask?a%20b", StatusSuccess, "a b"},
+		{"gemini://capsule.example/ask?a%2Bb", StatusSuccess, "a+b"},
+		{"gemini://capsule.example/ask?%zz", StatusBadRequest, "Malformed query"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.addr)
+		if err != nil {
+			t.Fatalf("Parse %s, %v", tt.addr, err)
+		}
+		var rec recorder
+		h.ServeGemini(&rec, &Request{URL: u})
+		if rec.status != tt.status || rec.meta != tt.meta {
+			t.Errorf("%s header %d %q, want %d %q", tt.addr, rec.status, rec.meta, tt.status, tt.meta)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	var h = RateLimit(2, time.Minute)(HandlerFunc(hello))
+	var (
+		one = &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40001}
+		// same client, another connection
+		again = &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40002}
+		two   = &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 40001}
+	)
+	var tests = []struct {
+		name   string
+		addr   net.Addr
+		status int
+		meta   string
+	}{
+		{"first", one, StatusSuccess, "text/gemini"},
+		{"second", again, StatusSuccess, "text/gemini"},
+		{"over the burst", one, StatusSlowDown, "30"},
+		{"other client", two, StatusSuccess, "text/gemini"},
+		{"still limited", again, StatusSlowDown, "30"},
+	}
+	var u, _ = url.Parse("gemini://capsule.example/")
+	for _, tt := range tests {
+		var rec recorder
+		h.ServeGemini(&rec, &Request{URL: u, RemoteAddr: tt.addr})
+		if rec.status != tt.status || rec.meta != tt.meta {
+			t.Errorf("%s: header %d %q, want %d %q", tt.name, rec.status, rec.meta, tt.status, tt.meta)
+		}
+	}
+}
+
+// the bucket fills again over the interval
+func TestLimiterRefill(t *testing.T) {
+	var lim = &limiter{rate: 1, burst: 1, buckets: make(map[string]*bucket)}
+	if wait := lim.take("client"); wait != 0 {
+		t.Fatalf("first take waits %d, want 0", wait)
+	}
+	if wait := lim.take("client"); wait != 1 {
+		t.Errorf("empty bucket waits %d, want 1", wait)
+	}
+	lim.buckets["client"].last = time.Now().Add(-2 * time.Second)
+	if wait := lim.take("client"); wait != 0 {
+		t.Errorf("refilled bucket waits %d, want 0", wait)
+	}
+	// idle clients are dropped by the sweep
+	lim.buckets["client"].last = time.Now().Add(-time.Hour)
+	lim.swept = time.Time{}
+	lim.sweep(time.Now())
+	if len(lim.buckets) != 0 {
+		t.Errorf("%d buckets after the sweep, want 0", len(lim.buckets))
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// Router matches the request path to the handler of a pattern. The
+// segments of a pattern are literal, a {name} parameter (one segment)
+// or a final {name...} parameter (the remainder of the path), e.g.
+//
+//	rt := server.NewRouter()
+//	rt.Use(server.Recover, server.Logger)
+//	rt.HandleFunc("/users/{id}", profile)
+//	rt.Handle("/files/{path...}", server.FileServer(os.DirFS("files")))
+//
+// Patterns are tried in the order they were added.
+type Router struct {
+	routes     []route
+	middleware []Middleware
+	NotFound   Handler // defaults to 51
+}
+
+// Middleware wraps the handler with behavior before or after it
+type Middleware func(Handler) Handler
+
+type route struct {
+	segments []string
+	handler  Handler
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle adds the pattern, later middleware (Use) applies too
+func (rt *Router) Handle(pattern string, h Handler) {
+	rt.routes = append(rt.routes, route{segments: split(pattern), handler: h})
+}
+
+func (rt *Router) HandleFunc(pattern string, f func(w ResponseWriter, r *Request)) {
+	rt.Handle(pattern, HandlerFunc(f))
+}
+
+// Use appends middleware, the first is the outermost
+func (rt *Router) Use(mw ...Middleware) {
+	rt.middleware = append(rt.middleware, mw...)
+}
+
+func (rt *Router) ServeGemini(w ResponseWriter, r *Request) {
+	var h Handler = HandlerFunc(rt.dispatch)
+	for i := len(rt.middleware) - 1; i >= 0; i-- {
+		h = rt.middleware[i](h)
+	}
+	h.ServeGemini(w, r)
+}
+
+func (rt *Router) dispatch(w ResponseWriter, r *Request) {
+	var path = split(r.URL.EscapedPath())
+	for _, rte := range rt.routes {
+		if params, ok := match(rte.segments, path); ok {
+			if len(params) > 0 {
+				r = r.WithContext(context.WithValue(r.Context(), routeParamsKey, params))
+			}
+			rte.handler.ServeGemini(w, r)
+			return
+		}
+	}
+	if rt.NotFound != nil {
+		rt.NotFound.ServeGemini(w, r)
+		return
+	}
+	NotFound(w, r)
+}
+
+// context key of the path parameters
+const routeParamsKey = "RouteParams"
+
+// Param is the value of the path parameter (empty when missing)
+func Param(r *Request, name string) string {
+	if params, ok := r.Context().Value(routeParamsKey).(map[string]string); ok {
+		return params[name]
+	}
+	return ""
+}
+
+func match(pattern []string, path []string) (map[string]string, bool) {
+	var params map[string]string
+	for i, seg := range pattern {
+		name, isParam := paramName(seg)
+		if isParam && strings.HasSuffix(name, "...") {
+			// the rest of the path, even empty
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[strings.TrimSuffix(name, "...")] = strings.Join(path[i:], "/")
+			return params, true
+		}
+		if i >= len(path) {
+			return nil, false
+		}
+		if !isParam {
+			if seg != path[i] {
+				return nil, false
+			}
+			continue
+		}
+		if path[i] == "" {
+			return nil, false
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[name] = path[i]
+	}
+	if len(pattern) != len(path) {
+		return nil, false
+	}
+	return params, true
+}
+
+func paramName(seg string) (string, bool) {
+	if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+		return seg[1 : len(seg)-1], true
+	}
+	return "", false
+}
+
+// path segments (unescaped), a trailing slash is an empty segment
+func split(p string) []string {
+	var segs = strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for i, seg := range segs {
+		if un, err := url.PathUnescape(seg); err == nil {
+			segs[i] = un
+		}
+	}
+	return segs
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// handler which answers the route name and its parameters
+func named(name string, params ...string) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		var vals []string
+		for _, p := range params {
+			vals = append(vals, p+"="+Param(r, p))
+		}
+		w.WriteHeader(StatusSuccess, strings.TrimSpace(name+" "+strings.Join(vals, " ")))
+	})
+}
+
+func serveRouter(t *testing.T, h Handler, addr string) *recorder {
+	t.Helper()
+	u, err := url.Parse(addr)
+	if err != nil {
+		t.Fatalf("Parse %s, %v", addr, err)
+	}
+	var rec recorder
+	h.ServeGemini(&rec, &Request{URL: u})
+	return &rec
+}
+
+func TestRouter(t *testing.T) {
+	var rt = NewRouter()
+	rt.Handle("/", named("home"))
+	rt.Handle("/users/me", named("me"))
+	rt.Handle("/users/{id}", named("user", "id"))
+	rt.Handle("/users/{id}/posts/{post}", named("post", "id", "post"))
+	rt.Handle("/files/{path...}", named("files", "path"))
+	rt.Handle("/docs/", named("docs"))
+	rt.Handle("/{page}", named("page", "page"))
+	var tests = []struct {
+		path   string
+		status int
+		meta   string
+	}{
+		{"/", StatusSuccess, "home"},
+		{"", StatusSuccess, "home"},
+		// the literal pattern was added before the parameter
+		{"/users/me", StatusSuccess, "me"},
+		{"/users/42", StatusSuccess, "user id=42"},
+		{"/users/a%20b", StatusSuccess, "user id=a b"},
+		{"/users/a%2Fb", StatusSuccess, "user id=a/b"},
+		{"/users/", StatusNotFound, "Not found"},
+		{"/users/42/posts/7", StatusSuccess, "post id=42 post=7"},
+		{"/users/42/posts", StatusNotFound, "Not found"},
+		{"/files/", StatusSuccess, "files path="},
+		{"/files/a/b.gmi", StatusSuccess, "files path=a/b.gmi"},
+		{"/files", StatusSuccess, "files path="},
+		{"/docs/", StatusSuccess, "docs"},
+		{"/docs", StatusSuccess, "page page=docs"},
+		{"/about", StatusSuccess, "page page=about"},
+		{"/about/more", StatusNotFound, "Not found"},
+	}
+	for _, tt := range tests {
+		var rec = serveRouter(t, rt, "gemini://capsule.example"+tt.path)
+		if rec.status != tt.status || rec.meta != tt.meta {
+			t.Errorf("%q: header %d %q, want %d %q", tt.path, rec.status, rec.meta, tt.status, tt.meta)
+		}
+	}
+}
+
+// the first pattern which matches wins, whatever its specificity
+func TestRouterOrder(t *testing.T) {
+	var rt = NewRouter()
+	rt.Handle("/{page}", named("page", "page"))
+	rt.Handle("/about", named("about"))
+	rt.NotFound = named("missing")
+	var tests = []struct {
+		path string
+		meta string
+	}{
+		{"/about", "page page=about"},
+		{"/a/b", "missing"},
+	}
+	for _, tt := range tests {
+		if rec := serveRouter(t, rt, "gemini://capsule.example"+tt.path); rec.meta != tt.meta {
+			t.Errorf("%q: meta %q, want %q", tt.path, rec.meta, tt.meta)
+		}
+	}
+}
+
+// the first middleware is the outermost, it wraps the not found too
+func TestRouterMiddleware(t *testing.T) {
+	var trace []string
+	var mark = func(name string) Middleware {
+		return func(h Handler) Handler {
+			return HandlerFunc(func(w ResponseWriter, r *Request) {
+				trace = append(trace, name+">")
+				h.ServeGemini(w, r)
+				trace = append(trace, "<"+name)
+			})
+		}
+	}
+	var rt = NewRouter()
+	rt.Use(mark("a"), mark("b"))
+	rt.HandleFunc("/", func(w ResponseWriter, r *Request) {
+		trace = append(trace, "handler")
+		w.WriteHeader(StatusSuccess, "text/gemini")
+	})
+	var tests = []struct {
+		path string
+		want string
+	}{
+		{"/", "[a> b> handler <b <a]"},
+		{"/missing", "[a> b> <b <a]"},
+	}
+	for _, tt := range tests {
+		trace = nil
+		serveRouter(t, rt, "gemini://capsule.example"+tt.path)
+		if got := fmt.Sprint(trace); got != tt.want {
+			t.Errorf("%q: order %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
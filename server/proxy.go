@@ -0,0 +1,211 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shrmpy/gmi"
+	"github.com/shrmpy/gmi/html"
+)
+
+// ReverseProxy forwards the requests below the prefix to the HTTP
+// service, e.g. with Upstream http://intranet:8080/wiki/ and Prefix
+// "/wiki" the request gemini://host/wiki/start?q is sent as
+// http://intranet:8080/wiki/start?q. HTML pages are converted to
+// gemtext (links into the upstream point back at the capsule), gemtext
+// and other bodies pass through.
+//
+//	up, _ := url.Parse("http://intranet:8080/wiki/")
+//	rt.Handle("/wiki/{path...}", &server.ReverseProxy{Upstream: up, Prefix: "/wiki"})
+type ReverseProxy struct {
+	Upstream *url.URL
+	Prefix   string       // URL path where the upstream is mounted
+	Client   *http.Client // defaults to a client with a 30 second timeout
+	// Convert turns the HTML into gemtext, defaults to html.Parse
+	Convert func(r io.Reader, base *url.URL) (*gmi.Tree, error)
+}
+
+const defaultProxyTimeout = 30 * time.Second
+
+func (p *ReverseProxy) ServeGemini(w ResponseWriter, r *Request) {
+	if r.Upload != nil {
+		w.WriteHeader(StatusBadRequest, "Titan upload is not proxied")
+		return
+	}
+	target, ok := p.target(r.URL)
+	if !ok {
+		NotFound(w, r)
+		return
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		w.WriteHeader(StatusBadRequest, "Request URL malformed")
+		return
+	}
+	req.Header.Set("X-Forwarded-For", clientIP(r.RemoteAddr))
+	req.Header.Set("X-Forwarded-Proto", "gemini")
+	req.Header.Set("Accept", "text/gemini, text/html;q=0.9, */*;q=0.8")
+	resp, err := p.client().Do(req)
+	if err != nil {
+		log.Printf("ERROR proxy %s, %v", target, err)
+		w.WriteHeader(StatusProxyError, "Upstream unavailable")
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 3 {
+		p.redirect(w, r, resp)
+		return
+	}
+	if resp.StatusCode/100 != 2 {
+		status, meta := geminiStatus(resp)
+		w.WriteHeader(status, meta)
+		return
+	}
+	var meta = resp.Header.Get("Content-Type")
+	if meta == "" {
+		meta = "application/octet-stream"
+	}
+	if !strings.HasPrefix(meta, "text/html") {
+		w.WriteHeader(StatusSuccess, meta)
+		if _, err = io.Copy(w, resp.Body); err != nil {
+			log.Printf("INFO proxy body %s, %v", target, err)
+		}
+		return
+	}
+	var convert = p.Convert
+	if convert == nil {
+		convert = html.Parse
+	}
+	tree, err := convert(resp.Body, resp.Request.URL)
+	if err != nil {
+		log.Printf("ERROR proxy convert %s, %v", target, err)
+		w.WriteHeader(StatusProxyError, "Upstream page conversion failed")
+		return
+	}
+	for _, lnk := range tree.Links() {
+		if lnk.URL == nil {
+			continue
+		}
+		if gu, ok := p.local(r.URL, lnk.URL); ok {
+			lnk.URL = gu
+		}
+	}
+	w.WriteHeader(StatusSuccess, "text/gemini; charset=utf-8")
+	tree.WriteTo(w)
+}
+
+// redirects are answered to the capsule client instead of followed
+func (p *ReverseProxy) client() *http.Client {
+	var cl http.Client
+	if p.Client != nil {
+		cl = *p.Client
+	} else {
+		cl.Timeout = defaultProxyTimeout
+	}
+	cl.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &cl
+}
+
+// 301 and 308 are permanent (31), the others temporary (30)
+func (p *ReverseProxy) redirect(w ResponseWriter, r *Request, resp *http.Response) {
+	loc, err := resp.Location()
+	if err != nil {
+		w.WriteHeader(StatusProxyError, "Upstream redirect without location")
+		return
+	}
+	if gu, ok := p.local(r.URL, loc); ok {
+		loc = gu
+	}
+	var permanent = resp.StatusCode == http.StatusMovedPermanently || resp.StatusCode == http.StatusPermanentRedirect
+	Redirect(w, r, loc.String(), permanent)
+}
+
+// HTTP failure to the Gemini status and meta
+func geminiStatus(resp *http.Response) (int, string) {
+	var text = http.StatusText(resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return StatusNotFound, text
+	case http.StatusGone:
+		return StatusGone, text
+	case http.StatusBadRequest, http.StatusRequestURITooLong:
+		return StatusBadRequest, text
+	case http.StatusTooManyRequests:
+		// the meta of slow down is the seconds to wait
+		var wait = "1"
+		if sec, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && sec > 0 {
+			wait = strconv.Itoa(sec)
+		}
+		return StatusSlowDown, wait
+	case http.StatusServiceUnavailable:
+		return StatusServerUnavailable, text
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return StatusProxyError, text
+	}
+	if resp.StatusCode/100 == 4 {
+		return StatusPermanentFailure, fmt.Sprintf("%d %s", resp.StatusCode, text)
+	}
+	return StatusTemporaryFailure, fmt.Sprintf("%d %s", resp.StatusCode, text)
+}
+
+// mount path without the trailing slash ("" at the root)
+func (p *ReverseProxy) mount() string {
+	return strings.TrimSuffix("/"+strings.Trim(p.Prefix, "/"), "/")
+}
+
+// upstream address of the request path below the prefix, the dot
+// segments are resolved first so the request cannot leave the mount
+func (p *ReverseProxy) target(req *url.URL) (*url.URL, bool) {
+	var (
+		prefix = p.mount()
+		rest   = path.Clean("/" + req.Path)
+	)
+	if strings.HasSuffix(req.Path, "/") && rest != "/" {
+		rest += "/"
+	}
+	if prefix != "" {
+		if rest != prefix && !strings.HasPrefix(rest, prefix+"/") {
+			return nil, false
+		}
+		rest = strings.TrimPrefix(rest, prefix)
+	}
+	var (
+		tu   = *p.Upstream
+		base = strings.TrimSuffix(tu.Path, "/")
+	)
+	tu.Path = base + "/" + strings.TrimPrefix(rest, "/")
+	if !strings.HasPrefix(tu.Path, base+"/") {
+		return nil, false
+	}
+	tu.RawPath, tu.RawQuery, tu.Fragment = "", req.RawQuery, ""
+	return &tu, true
+}
+
+// capsule address of the upstream URL (false when it is outside of
+// the upstream)
+func (p *ReverseProxy) local(req *url.URL, lu *url.URL) (*url.URL, bool) {
+	var base = strings.TrimSuffix(p.Upstream.Path, "/")
+	if lu.Scheme != p.Upstream.Scheme || lu.Host != p.Upstream.Host {
+		return nil, false
+	}
+	if lu.Path != base && !strings.HasPrefix(lu.Path, base+"/") {
+		return nil, false
+	}
+	var gu = *req
+	gu.Path = p.mount() + strings.TrimPrefix(lu.Path, base)
+	if gu.Path == "" {
+		gu.Path = "/"
+	}
+	gu.RawPath, gu.RawQuery, gu.Fragment = "", lu.RawQuery, lu.Fragment
+	return &gu, true
+}
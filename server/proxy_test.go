@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// response of the handler without the connection
+type recorder struct {
+	status int
+	meta   string
+	body   bytes.Buffer
+}
+
+func (rec *recorder) WriteHeader(status int, meta string) {
+	rec.status, rec.meta = status, meta
+}
+func (rec *recorder) Write(p []byte) (int, error) {
+	return rec.body.Write(p)
+}
+
+var pngBody = []byte("\x89PNG\r\n\x1a\n\x00binary")
+
+// wiki stand-in, admin counts the requests which escaped the mount
+func upstream(t *testing.T, admin *int32) *httptest.Server {
+	var mux = http.NewServeMux()
+	mux.HandleFunc("/wiki/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><body><h1>Start</h1>
+<p><a href="/wiki/other?q=1">Other</a></p>
+<p><a href="https://elsewhere.example/">Away</a></p>
+</body></html>`))
+	})
+	mux.HandleFunc("/wiki/notes.gmi", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/gemini")
+		w.Write([]byte("# Notes\n=> /wiki/page Page\n"))
+	})
+	mux.HandleFunc("/wiki/logo.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngBody)
+	})
+	mux.HandleFunc("/wiki/busy", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("/wiki/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/wiki/page", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/wiki/found", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/wiki/notes.gmi", http.StatusFound)
+	})
+	mux.HandleFunc("/wiki/away", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://elsewhere.example/x", http.StatusFound)
+	})
+	mux.HandleFunc("/admin/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(admin, 1)
+		w.Write([]byte("secret"))
+	})
+	var srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func proxyGet(t *testing.T, p *ReverseProxy, addr string) *recorder {
+	t.Helper()
+	u, err := url.Parse(addr)
+	if err != nil {
+		t.Fatalf("Parse %s, %v", addr, err)
+	}
+	var rec recorder
+	p.ServeGemini(&rec, &Request{URL: u})
+	return &rec
+}
+
+func testProxy(t *testing.T, admin *int32) *ReverseProxy {
+	var srv = upstream(t, admin)
+	up, err := url.Parse(srv.URL + "/wiki/")
+	if err != nil {
+		t.Fatalf("Parse upstream, %v", err)
+	}
+	return &ReverseProxy{Upstream: up, Prefix: "/wiki", Client: srv.Client()}
+}
+
+func TestProxyHTML(t *testing.T) {
+	var admin int32
+	var rec = proxyGet(t, testProxy(t, &admin), "gemini://capsule.example/wiki/page")
+	if rec.status != StatusSuccess || rec.meta != "text/gemini; charset=utf-8" {
+		t.Fatalf("header %d %s, want 20 text/gemini", rec.status, rec.meta)
+	}
+	var body = rec.body.String()
+	if !strings.Contains(body, "# Start") {
+		t.Errorf("heading missing from %q", body)
+	}
+	// links into the upstream point back at the capsule
+	if !strings.Contains(body, "=> gemini://capsule.example/wiki/other?q=1 Other") {
+		t.Errorf("local link not rewritten in %q", body)
+	}
+	if !strings.Contains(body, "=> https://elsewhere.example/ Away") {
+		t.Errorf("outside link changed in %q", body)
+	}
+}
+
+func TestProxyPassThrough(t *testing.T) {
+	var admin int32
+	var p = testProxy(t, &admin)
+	var tests = []struct {
+		addr string
+		meta string
+		body []byte
+	}{
+		{"gemini://capsule.example/wiki/notes.gmi", "text/gemini", []byte("# Notes\n=> /wiki/page Page\n")},
+		{"gemini://capsule.example/wiki/logo.png", "image/png", pngBody},
+	}
+	for _, tt := range tests {
+		var rec = proxyGet(t, p, tt.addr)
+		if rec.status != StatusSuccess || rec.meta != tt.meta {
+			t.Errorf("%s header %d %s, want 20 %s", tt.addr, rec.status, rec.meta, tt.meta)
+		}
+		if !bytes.Equal(rec.body.Bytes(), tt.body) {
+			t.Errorf("%s body %q, want %q", tt.addr, rec.body.Bytes(), tt.body)
+		}
+	}
+}
+
+func TestProxyStatus(t *testing.T) {
+	var admin int32
+	var p = testProxy(t, &admin)
+	var tests = []struct {
+		addr   string
+		status int
+		meta   string
+	}{
+		{"gemini://capsule.example/wiki/missing", StatusNotFound, "Not Found"},
+		{"gemini://capsule.example/wiki/busy", StatusSlowDown, "7"},
+		{"gemini://capsule.example/wiki/moved", StatusPermanentRedirect, "gemini://capsule.example/wiki/page"},
+		{"gemini://capsule.example/wiki/found", StatusRedirect, "gemini://capsule.example/wiki/notes.gmi"},
+		{"gemini://capsule.example/wiki/away", StatusRedirect, "https://elsewhere.example/x"},
+		{"gemini://capsule.example/other", StatusNotFound, "Not found"},
+	}
+	for _, tt := range tests {
+		var rec = proxyGet(t, p, tt.addr)
+		if rec.status != tt.status || rec.meta != tt.meta {
+			t.Errorf("%s header %d %q, want %d %q", tt.addr, rec.status, rec.meta, tt.status, tt.meta)
+		}
+	}
+}
+
+func TestProxyTraversal(t *testing.T) {
+	var admin int32
+	var p = testProxy(t, &admin)
+	for _, addr := range []string{
+		"gemini://capsule.example/wiki/../admin/secret",
+		"gemini://capsule.example/wiki/%2e%2e/admin/secret",
+		"gemini://capsule.example/wiki/page/../../admin/secret",
+	} {
+		var rec = proxyGet(t, p, addr)
+		if rec.status != StatusNotFound {
+			t.Errorf("%s status %d, want 51", addr, rec.status)
+		}
+	}
+	if n := atomic.LoadInt32(&admin); n != 0 {
+		t.Errorf("upstream outside of the mount was requested %d times", n)
+	}
+}
@@ -0,0 +1,463 @@
+// Package server implements Gemini capsules, the handler shape
+// follows net/http: a Handler receives the Request and answers with
+// the status, meta and body through the ResponseWriter.
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status codes of the response header
+const (
+	StatusInput                    = 10
+	StatusSensitiveInput           = 11
+	StatusSuccess                  = 20
+	StatusRedirect                 = 30
+	StatusPermanentRedirect        = 31
+	StatusTemporaryFailure         = 40
+	StatusServerUnavailable        = 41
+	StatusCGIError                 = 42
+	StatusProxyError               = 43
+	StatusSlowDown                 = 44
+	StatusPermanentFailure         = 50
+	StatusNotFound                 = 51
+	StatusGone                     = 52
+	StatusProxyRequestRefused      = 53
+	StatusBadRequest               = 59
+	StatusCertificateRequired      = 60
+	StatusCertificateNotAuthorized = 61
+	StatusCertificateNotValid      = 62
+)
+
+// limits from the specification
+const (
+	maxRequest = 1024
+	maxMeta    = 1024
+)
+
+var ErrServerClosed = errors.New("gemini: Server closed")
+
+// Handler responds to a Gemini request
+type Handler interface {
+	ServeGemini(w ResponseWriter, r *Request)
+}
+
+// HandlerFunc adapts the function to the Handler interface
+type HandlerFunc func(w ResponseWriter, r *Request)
+
+func (f HandlerFunc) ServeGemini(w ResponseWriter, r *Request) {
+	f(w, r)
+}
+
+// ResponseWriter sends the response header once, before the body;
+// writing the body without a header sends 20 text/gemini
+type ResponseWriter interface {
+	WriteHeader(status int, meta string)
+	Write(p []byte) (int, error)
+}
+
+// Request is the absolute URL sent by the client with the details of
+// the connection
+type Request struct {
+	URL         *url.URL
+	RemoteAddr  net.Addr
+	Certificate *x509.Certificate // client certificate (nil when none)
+	Upload      *Upload           // body of a Titan request (nil for Gemini)
+	TLS         *tls.ConnectionState
+	ctx         context.Context
+}
+
+// Context is canceled when the handler returns or the server shuts down
+// (a closed connection is noticed by the failed write of the response)
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// WithContext is a shallow copy of the request with the context
+func (r *Request) WithContext(ctx context.Context) *Request {
+	var cp = *r
+	cp.ctx = ctx
+	return &cp
+}
+
+// Server listens for TLS connections and hands the requests to the Handler
+type Server struct {
+	Addr         string // defaults to :1965
+	Handler      Handler
+	TLSConfig    *tls.Config
+	ReadTimeout  time.Duration // time limit for the request line
+	WriteTimeout time.Duration // time limit for the response
+	// Titan uploads up to the size are accepted (refused when zero)
+	MaxUploadSize int64
+	// time limit for the upload body, defaults to the ReadTimeout
+	UploadTimeout time.Duration
+	// host names of the capsule, requests for other hosts are refused
+	// with 53 (empty accepts the server name of the TLS handshake)
+	Hosts []string
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     sync.WaitGroup
+	done      chan struct{}
+	cancel    context.CancelFunc
+	ctx       context.Context
+}
+
+// ListenAndServeTLS listens on the address with the certificate pair
+func (srv *Server) ListenAndServeTLS(certFile string, keyFile string) error {
+	cert, err := LoadCertificate(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("Server certificate, %w", err)
+	}
+	var cfg = srv.tlsConfig()
+	cfg.Certificates = append(cfg.Certificates, cert)
+	return srv.listen(cfg)
+}
+
+// ListenAndServe listens with the certificates of the TLSConfig
+func (srv *Server) ListenAndServe() error {
+	var cfg = srv.tlsConfig()
+	if len(cfg.Certificates) == 0 && cfg.GetCertificate == nil {
+		return fmt.Errorf("Server requires a certificate")
+	}
+	return srv.listen(cfg)
+}
+
+func (srv *Server) listen(cfg *tls.Config) error {
+	var addr = srv.Addr
+	if addr == "" {
+		addr = ":1965"
+	}
+	ln, err := tls.Listen("tcp", addr, cfg)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(ln)
+}
+
+// ListenAndServeTLS starts a server with the handler
+func ListenAndServeTLS(addr string, certFile string, keyFile string, h Handler) error {
+	var srv = &Server{Addr: addr, Handler: h}
+	return srv.ListenAndServeTLS(certFile, keyFile)
+}
+
+// client certificates are requested but not verified (self-signed)
+func (srv *Server) tlsConfig() *tls.Config {
+	var cfg *tls.Config
+	if srv.TLSConfig != nil {
+		cfg = srv.TLSConfig.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+	if cfg.ClientAuth == tls.NoClientCert {
+		cfg.ClientAuth = tls.RequestClientCert
+	}
+	return cfg
+}
+
+// Serve accepts connections on the (TLS) listener until Shutdown
+func (srv *Server) Serve(ln net.Listener) error {
+	if err := srv.track(ln); err != nil {
+		return err
+	}
+	defer srv.untrack(ln)
+	var delay time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-srv.done:
+				return ErrServerClosed
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				// back off the temporary failures like net/http
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				log.Printf("ERROR accept, %v; retrying in %v", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+		srv.conns.Add(1)
+		go srv.serveConn(conn)
+	}
+}
+
+func (srv *Server) track(ln net.Listener) error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.done == nil {
+		srv.done = make(chan struct{})
+		srv.ctx, srv.cancel = context.WithCancel(context.Background())
+	}
+	select {
+	case <-srv.done:
+		return ErrServerClosed
+	default:
+	}
+	if srv.listeners == nil {
+		srv.listeners = make(map[net.Listener]struct{})
+	}
+	srv.listeners[ln] = struct{}{}
+	return nil
+}
+
+func (srv *Server) untrack(ln net.Listener) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	delete(srv.listeners, ln)
+}
+
+// Shutdown closes the listeners and waits for the open requests (until
+// the context ends, then the requests are canceled)
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.mu.Lock()
+	if srv.done == nil {
+		srv.done = make(chan struct{})
+		srv.ctx, srv.cancel = context.WithCancel(context.Background())
+	}
+	select {
+	case <-srv.done:
+	default:
+		close(srv.done)
+	}
+	var err error
+	for ln := range srv.listeners {
+		if cerr := ln.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	srv.mu.Unlock()
+
+	var idle = make(chan struct{})
+	go func() {
+		srv.conns.Wait()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		srv.cancel()
+		return ctx.Err()
+	}
+	srv.cancel()
+	return err
+}
+
+func (srv *Server) serveConn(conn net.Conn) {
+	defer srv.conns.Done()
+	defer conn.Close()
+	var w = &response{conn: conn, buf: bufio.NewWriter(conn)}
+	defer w.finish()
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("ERROR handler panic %s, %v", conn.RemoteAddr(), v)
+			w.WriteHeader(StatusTemporaryFailure, "Internal error")
+		}
+	}()
+
+	if srv.ReadTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(srv.ReadTimeout))
+	}
+	var req = &Request{RemoteAddr: conn.RemoteAddr()}
+	if tc, ok := conn.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			log.Printf("INFO handshake %s, %v", conn.RemoteAddr(), err)
+			w.header = true
+			return
+		}
+		var state = tc.ConnectionState()
+		req.TLS = &state
+		if len(state.PeerCertificates) > 0 {
+			req.Certificate = state.PeerCertificates[0]
+		}
+	}
+	rdr, lu, status, err := readRequest(conn, srv.MaxUploadSize > 0)
+	if err == nil && lu.Scheme == "titan" {
+		req.Upload, status, err = readUpload(lu, rdr, srv.MaxUploadSize)
+	}
+	if err != nil {
+		log.Printf("INFO bad request %s, %v", conn.RemoteAddr(), err)
+		w.WriteHeader(status, err.Error())
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	if req.Upload != nil {
+		// the handler reads the body, a slow uploader is cut off
+		var limit = srv.UploadTimeout
+		if limit <= 0 {
+			limit = srv.ReadTimeout
+		}
+		if limit > 0 {
+			conn.SetReadDeadline(time.Now().Add(limit))
+		}
+	}
+	if srv.WriteTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(srv.WriteTimeout))
+	}
+	if !srv.local(lu, conn, req.TLS) {
+		log.Printf("INFO proxy request %s, %s", conn.RemoteAddr(), lu.Host)
+		w.WriteHeader(StatusProxyRequestRefused, "Proxy requests are refused")
+		return
+	}
+	req.URL = lu
+	ctx, cancel := context.WithCancel(srv.ctx)
+	defer cancel()
+	req.ctx = ctx
+
+	var h = srv.Handler
+	if h == nil {
+		h = NotFoundHandler()
+	}
+	h.ServeGemini(w, req)
+}
+
+// the request is for a host of the server and the port it listens on
+func (srv *Server) local(lu *url.URL, conn net.Conn, state *tls.ConnectionState) bool {
+	var port = lu.Port()
+	if port == "" {
+		port = "1965"
+	}
+	if _, lp, err := net.SplitHostPort(conn.LocalAddr().String()); err == nil && lp != port {
+		return false
+	}
+	var host = strings.TrimSuffix(lu.Hostname(), ".")
+	if len(srv.Hosts) > 0 {
+		for _, h := range srv.Hosts {
+			if strings.EqualFold(host, h) {
+				return true
+			}
+		}
+		return false
+	}
+	if state != nil && state.ServerName != "" {
+		return strings.EqualFold(host, state.ServerName)
+	}
+	// without SNI (IP address) the name cannot be checked
+	return true
+}
+
+// request line is the absolute URL terminated by CRLF
+func readRequest(conn net.Conn, titan bool) (*bufio.Reader, *url.URL, int, error) {
+	var (
+		rdr = bufio.NewReaderSize(conn, maxRequest+2)
+		row []byte
+	)
+	for {
+		frag, prefix, err := rdr.ReadLine()
+		if err != nil {
+			return nil, nil, StatusBadRequest, fmt.Errorf("Request line, %w", err)
+		}
+		row = append(row, frag...)
+		if len(row) > maxRequest {
+			return nil, nil, StatusBadRequest, fmt.Errorf("Request exceeds 1024 bytes")
+		}
+		if !prefix {
+			break
+		}
+	}
+	lu, err := url.Parse(string(row))
+	if err != nil {
+		return nil, nil, StatusBadRequest, fmt.Errorf("Request URL malformed")
+	}
+	if !lu.IsAbs() || lu.Host == "" {
+		return nil, nil, StatusBadRequest, fmt.Errorf("Request URL must be absolute")
+	}
+	if lu.Scheme != "gemini" && !(titan && lu.Scheme == "titan") {
+		return nil, nil, StatusProxyRequestRefused, fmt.Errorf("Proxy requests are refused")
+	}
+	if lu.User != nil {
+		return nil, nil, StatusBadRequest, fmt.Errorf("Request URL must not have userinfo")
+	}
+	return rdr, lu, 0, nil
+}
+
+// response implements ResponseWriter over the connection
+type response struct {
+	conn   net.Conn
+	buf    *bufio.Writer
+	header bool
+	status int
+}
+
+func (w *response) WriteHeader(status int, meta string) {
+	if w.header {
+		log.Printf("INFO superfluous WriteHeader %d, %s", status, w.conn.RemoteAddr())
+		return
+	}
+	w.header = true
+	w.status = status
+	if status < 10 || status > 69 {
+		log.Printf("ERROR invalid status %d, replaced by 40", status)
+		status, meta = StatusTemporaryFailure, "Invalid status"
+	}
+	// meta cannot span lines
+	meta = strings.NewReplacer("\r", " ", "\n", " ").Replace(meta)
+	if len(meta) > maxMeta {
+		meta = meta[:maxMeta]
+	}
+	fmt.Fprintf(w.buf, "%d %s\r\n", status, meta)
+}
+
+func (w *response) Write(p []byte) (int, error) {
+	if !w.header {
+		w.WriteHeader(StatusSuccess, "text/gemini")
+	}
+	if w.status != 0 && w.status/10 != 2 {
+		// only success responses have a body
+		return 0, fmt.Errorf("Response body with status %d", w.status)
+	}
+	return w.buf.Write(p)
+}
+
+// a handler that wrote nothing sends an empty page
+func (w *response) finish() {
+	if !w.header {
+		w.WriteHeader(StatusSuccess, "text/gemini")
+	}
+	if err := w.buf.Flush(); err != nil {
+		log.Printf("INFO response %s, %v", w.conn.RemoteAddr(), err)
+	}
+}
+
+// NotFound replies with 51
+func NotFound(w ResponseWriter, r *Request) {
+	w.WriteHeader(StatusNotFound, "Not found")
+}
+
+func NotFoundHandler() Handler {
+	return HandlerFunc(NotFound)
+}
+
+// Redirect replies with 30 (or 31 when permanent)
+func Redirect(w ResponseWriter, r *Request, target string, permanent bool) {
+	var status = StatusRedirect
+	if permanent {
+		status = StatusPermanentRedirect
+	}
+	w.WriteHeader(status, target)
+}
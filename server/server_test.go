@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// server for the handler on a local port, the address is host:port
+func startServer(t *testing.T, srv *Server) string {
+	t.Helper()
+	certPEM, keyPEM, err := NewCertificate(CertOptions{Hosts: []string{"localhost", "127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{pair}}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", srv.tlsConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	return ln.Addr().String()
+}
+
+// send the request line, the answer is the whole response
+func exchange(t *testing.T, addr string, sni string, line string) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, ServerName: sni})
+	if err != nil {
+		t.Fatalf("Dial, %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err = io.WriteString(conn, line); err != nil {
+		t.Fatalf("Write, %v", err)
+	}
+	buf, err := io.ReadAll(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatalf("Read, %v", err)
+	}
+	return string(buf)
+}
+
+func hello(w ResponseWriter, r *Request) {
+	w.WriteHeader(StatusSuccess, "text/gemini")
+	io.WriteString(w, "hello "+r.URL.Path)
+}
+
+func TestServeRequestLine(t *testing.T) {
+	var addr = startServer(t, &Server{Handler: HandlerFunc(hello)})
+	_, port, _ := net.SplitHostPort(addr)
+	var other = "1"
+	if port == other {
+		other = "2"
+	}
+	var tests = []struct {
+		name string
+		sni  string
+		line string
+		want string
+	}{
+		{"success", "localhost", "gemini://localhost:" + port + "/page\r\n", "20 text/gemini\r\nhello /page"},
+		{"name case", "localhost", "gemini://LocalHost:" + port + "/\r\n", "20 text/gemini\r\nhello /"},
+		{"other host", "localhost", "gemini://example.org:" + port + "/\r\n", "53 Proxy requests are refused\r\n"},
+		{"other port", "localhost", "gemini://localhost:" + other + "/\r\n", "53 Proxy requests are refused\r\n"},
+		{"default port", "localhost", "gemini://localhost/\r\n", "53 Proxy requests are refused\r\n"},
+		{"other scheme", "localhost", "https://localhost:" + port + "/\r\n", "53 Proxy requests are refused\r\n"},
+		{"no sni", "", "gemini://127.0.0.1:" + port + "/\r\n", "20 text/gemini\r\nhello /"},
+		{"relative", "localhost", "/page\r\n", "59 Request URL must be absolute\r\n"},
+		{"userinfo", "localhost", "gemini://u@localhost:" + port + "/\r\n", "59 Request URL must not have userinfo\r\n"},
+		{"too long", "localhost", "gemini://localhost:" + port + "/" + strings.Repeat("a", 1024) + "\r\n", "59 Request exceeds 1024 bytes\r\n"},
+	}
+	for _, tt := range tests {
+		if got := exchange(t, addr, tt.sni, tt.line); got != tt.want {
+			t.Errorf("%s: response %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestServeHosts(t *testing.T) {
+	var addr = startServer(t, &Server{Handler: HandlerFunc(hello), Hosts: []string{"capsule.example"}})
+	_, port, _ := net.SplitHostPort(addr)
+	var tests = []struct {
+		host string
+		want string
+	}{
+		{"capsule.example", "20 text/gemini\r\nhello /"},
+		{"localhost", "53 Proxy requests are refused\r\n"},
+	}
+	for _, tt := range tests {
+		if got := exchange(t, addr, tt.host, "gemini://"+tt.host+":"+port+"/\r\n"); got != tt.want {
+			t.Errorf("%s: response %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+// the panic of the handler is answered with 40, the server goes on
+func TestServePanic(t *testing.T) {
+	var addr = startServer(t, &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/boom" {
+			panic("boom")
+		}
+		hello(w, r)
+	})})
+	_, port, _ := net.SplitHostPort(addr)
+	var base = "gemini://localhost:" + port
+	if got, want := exchange(t, addr, "localhost", base+"/boom\r\n"), "40 Internal error\r\n"; got != want {
+		t.Errorf("panic response %q, want %q", got, want)
+	}
+	if got, want := exchange(t, addr, "localhost", base+"/\r\n"), "20 text/gemini\r\nhello /"; got != want {
+		t.Errorf("response after the panic %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Upload is the body of a Titan request, the parameters are removed
+// from the request URL path
+type Upload struct {
+	Mime  string
+	Size  int64
+	Token string
+	Body  io.Reader // exactly Size bytes
+}
+
+// split the ;mime=..;size=..;token=.. parameters from the path
+func readUpload(lu *url.URL, rdr *bufio.Reader, max int64) (*Upload, int, error) {
+	var (
+		parts = strings.Split(lu.EscapedPath(), ";")
+		up    = &Upload{Mime: "text/gemini", Size: -1}
+	)
+	for _, kv := range parts[1:] {
+		key, val, _ := strings.Cut(kv, "=")
+		val, err := url.PathUnescape(val)
+		if err != nil {
+			return nil, StatusBadRequest, fmt.Errorf("Titan parameter %s malformed", key)
+		}
+		switch key {
+		case "mime":
+			if _, _, err = mime.ParseMediaType(val); err != nil || !strings.Contains(val, "/") {
+				return nil, StatusBadRequest, fmt.Errorf("Titan mime malformed")
+			}
+			up.Mime = val
+		case "token":
+			up.Token = val
+		case "size":
+			if up.Size, err = strconv.ParseInt(val, 10, 64); err != nil || up.Size < 0 {
+				return nil, StatusBadRequest, fmt.Errorf("Titan size malformed")
+			}
+		}
+	}
+	if up.Size < 0 {
+		return nil, StatusBadRequest, fmt.Errorf("Titan size is required")
+	}
+	if up.Size > max {
+		return nil, StatusBadRequest, fmt.Errorf("Upload exceeds %d bytes", max)
+	}
+	p, err := url.PathUnescape(parts[0])
+	if err != nil {
+		return nil, StatusBadRequest, fmt.Errorf("Request URL malformed")
+	}
+	lu.Path, lu.RawPath = p, parts[0]
+	up.Body = io.LimitReader(rdr, up.Size)
+	return up, 0, nil
+}
+
+// Titan passes uploads of the size limit to the handler, a non-empty
+// token must match the token of the request. With an empty token every
+// upload reaches the handler, which has to authorize the client itself.
+func Titan(maxSize int64, token string, f func(w ResponseWriter, r *Request, up *Upload)) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		var up = r.Upload
+		if up == nil {
+			w.WriteHeader(StatusBadRequest, "Titan upload required")
+			return
+		}
+		if up.Size > maxSize {
+			w.WriteHeader(StatusBadRequest, fmt.Sprintf("Upload exceeds %d bytes", maxSize))
+			return
+		}
+		if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(up.Token)) != 1 {
+			w.WriteHeader(StatusPermanentFailure, "Upload token refused")
+			return
+		}
+		f(w, r, up)
+	})
+}
+
+// UploadFiles writes the uploads into the directory (a zero size upload
+// deletes the file) and redirects to the page. The MIME type of the
+// upload has to match the file name (see MimeType). The token is
+// required, with an empty token every upload is refused (use Titan for
+// other checks of the client). E.g. next to FileServer
+//
+//	srv.MaxUploadSize = 1 << 20
+//	files := server.FileServer(os.DirFS("capsule"))
+//	edits := server.UploadFiles("capsule", 1<<20, "secret")
+//	srv.Handler = server.HandlerFunc(func(w server.ResponseWriter, r *server.Request) {
+//		if r.Upload != nil {
+//			edits.ServeGemini(w, r)
+//			return
+//		}
+//		files.ServeGemini(w, r)
+//	})
+func UploadFiles(dir string, maxSize int64, token string) Handler {
+	if token == "" {
+		log.Printf("ERROR upload token is empty, uploads into %s are refused", dir)
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			w.WriteHeader(StatusPermanentFailure, "Upload token refused")
+		})
+	}
+	return Titan(maxSize, token, func(w ResponseWriter, r *Request, up *Upload) {
+		name, ok := cleanPath(r.URL.Path)
+		if !ok || name == "." || strings.HasSuffix(r.URL.Path, "/") {
+			w.WriteHeader(StatusBadRequest, "Upload path must name a file")
+			return
+		}
+		if up.Size > 0 && !mimeMatches(name, up.Mime) {
+			w.WriteHeader(StatusBadRequest, "Upload mime must be "+MimeType(name))
+			return
+		}
+		var target = filepath.Join(dir, filepath.FromSlash(name))
+		if up.Size == 0 {
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				log.Printf("ERROR upload delete %s, %v", name, err)
+				w.WriteHeader(StatusTemporaryFailure, "Delete failed")
+				return
+			}
+		} else if err := writeUpload(target, up); err != nil {
+			log.Printf("ERROR upload %s, %v", name, err)
+			w.WriteHeader(StatusTemporaryFailure, "Upload failed")
+			return
+		}
+		log.Printf("INFO upload %s, %d bytes", name, up.Size)
+		var page = *r.URL
+		page.Scheme, page.RawQuery = "gemini", ""
+		Redirect(w, r, page.String(), false)
+	})
+}
+
+// the type of the upload is the type of the file name (parameters like
+// the charset aside), names without a known type take any upload
+func mimeMatches(name string, mt string) bool {
+	var want = MimeType(name)
+	if want == "application/octet-stream" {
+		return true
+	}
+	want, _, _ = mime.ParseMediaType(want)
+	mt, _, _ = mime.ParseMediaType(mt)
+	return mt == want
+}
+
+// write to a temporary file first, a broken upload keeps the old page
+func writeUpload(target string, up *Upload) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, up.Body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if n != up.Size {
+		return fmt.Errorf("Upload short, %d of %d bytes", n, up.Size)
+	}
+	if err = os.Chmod(tmp.Name(), fs.FileMode(0644)); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadUpload(t *testing.T) {
+	var tests = []struct {
+		addr   string
+		path   string
+		mime   string
+		size   int64
+		token  string
+		status int
+	}{
+		{"titan://capsule.example/page.gmi;size=5", "/page.gmi", "text/gemini", 5, "", 0},
+		{"titan://capsule.example/a%20b.txt;mime=text/plain;size=0;token=s%3Bcret", "/a b.txt", "text/plain", 0, "s;cret", 0},
+		{"titan://capsule.example/img.png;token=t;size=3;mime=image/png", "/img.png", "image/png", 3, "t", 0},
+		{"titan://capsule.example/page.gmi;mime=text/gemini", "", "", 0, "", StatusBadRequest},
+		{"titan://capsule.example/page.gmi;size=-1", "", "", 0, "", StatusBadRequest},
+		{"titan://capsule.example/page.gmi;size=ten", "", "", 0, "", StatusBadRequest},
+		{"titan://capsule.example/page.gmi;size=101", "", "", 0, "", StatusBadRequest},
+		{"titan://capsule.example/page.gmi;mime=text;size=1", "", "", 0, "", StatusBadRequest},
+		{"titan://capsule.example/page.gmi;mime=text/plain%3Bcharset;size=1", "", "", 0, "", StatusBadRequest},
+	}
+	for _, tt := range tests {
+		var lu = mustURL(t, tt.addr)
+		up, status, err := readUpload(lu, bufio.NewReader(strings.NewReader("hello world")), 100)
+		if status != tt.status {
+			t.Errorf("%s: status %d (error %v), want %d", tt.addr, status, err, tt.status)
+			continue
+		}
+		if tt.status != 0 {
+			continue
+		}
+		body, _ := io.ReadAll(up.Body)
+		if lu.Path != tt.path || up.Mime != tt.mime || up.Size != tt.size || up.Token != tt.token || int64(len(body)) != tt.size {
+			t.Errorf("%s: upload %s %q %d %q %q", tt.addr, lu.Path, up.Mime, up.Size, up.Token, body)
+		}
+	}
+}
+
+func TestTitan(t *testing.T) {
+	var h = Titan(10, "secret", func(w ResponseWriter, r *Request, up *Upload) {
+		body, _ := io.ReadAll(up.Body)
+		w.WriteHeader(StatusSuccess, string(body))
+	})
+	var open = Titan(10, "", func(w ResponseWriter, r *Request, up *Upload) {
+		w.WriteHeader(StatusSuccess, "accepted "+up.Token)
+	})
+	var tests = []struct {
+		name   string
+		h      Handler
+		up     *Upload
+		status int
+		meta   string
+	}{
+		{"token", h, &Upload{Size: 2, Token: "secret", Body: strings.NewReader("hi")}, StatusSuccess, "hi"},
+		{"wrong token", h, &Upload{Size: 2, Token: "guess", Body: strings.NewReader("hi")}, StatusPermanentFailure, "Upload token refused"},
+		{"no token", h, &Upload{Size: 2, Body: strings.NewReader("hi")}, StatusPermanentFailure, "Upload token refused"},
+		{"too large", h, &Upload{Size: 11, Token: "secret", Body: strings.NewReader("")}, StatusBadRequest, "Upload exceeds 10 bytes"},
+		{"gemini request", h, nil, StatusBadRequest, "Titan upload required"},
+		{"handler checks", open, &Upload{Size: 0, Token: "any", Body: strings.NewReader("")}, StatusSuccess, "accepted any"},
+	}
+	for _, tt := range tests {
+		var rec recorder
+		tt.h.ServeGemini(&rec, &Request{URL: mustURL(t, "titan://capsule.example/page.gmi"), Upload: tt.up})
+		if rec.status != tt.status || rec.meta != tt.meta {
+			t.Errorf("%s: header %d %q, want %d %q", tt.name, rec.status, rec.meta, tt.status, tt.meta)
+		}
+	}
+}
+
+func TestUploadFiles(t *testing.T) {
+	var dir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "old.gmi"), []byte("# Old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var h = UploadFiles(dir, 100, "secret")
+	var tests = []struct {
+		name   string
+		path   string
+		mime   string
+		body   string
+		status int
+		meta   string
+		file   string // the page afterwards, "-" when missing
+	}{
+		{"new page", "/notes/new.gmi", "text/gemini", "# New\n", StatusRedirect, "gemini://capsule.example/notes/new.gmi", "# New\n"},
+		{"replace", "/old.gmi", "text/gemini; charset=utf-8", "# Replaced\n", StatusRedirect, "gemini://capsule.example/old.gmi", "# Replaced\n"},
+		{"text", "/notes.txt", "text/plain", "plain", StatusRedirect, "gemini://capsule.example/notes.txt", "plain"},
+		{"unknown type", "/README", "text/gemini", "any", StatusRedirect, "gemini://capsule.example/README", "any"},
+		{"wrong mime", "/page.gmi", "image/png", "png", StatusBadRequest, "Upload mime must be text/gemini", "-"},
+		{"image as gemtext", "/logo.png", "text/gemini", "# x", StatusBadRequest, "Upload mime must be image/png", "-"},
+		{"delete", "/old.gmi", "text/gemini", "", StatusRedirect, "gemini://capsule.example/old.gmi", "-"},
+		{"delete missing", "/missing.gmi", "image/png", "", StatusRedirect, "gemini://capsule.example/missing.gmi", "-"},
+		{"directory", "/notes/", "text/gemini", "x", StatusBadRequest, "Upload path must name a file", ""},
+		{"hidden", "/.hidden.gmi", "text/gemini", "x", StatusBadRequest, "Upload path must name a file", "-"},
+		// the name is cleaned inside the directory
+		{"traversal", "/../outside.gmi", "text/gemini", "x", StatusRedirect, "gemini://capsule.example/../outside.gmi", "x"},
+	}
+	for _, tt := range tests {
+		var up = &Upload{Mime: tt.mime, Size: int64(len(tt.body)), Token: "secret", Body: strings.NewReader(tt.body)}
+		var rec recorder
+		h.ServeGemini(&rec, &Request{URL: mustURL(t, "titan://capsule.example"+tt.path), Upload: up})
+		if rec.status != tt.status || rec.meta != tt.meta {
+			t.Errorf("%s: header %d %q, want %d %q", tt.name, rec.status, rec.meta, tt.status, tt.meta)
+		}
+		if tt.file == "" {
+			continue
+		}
+		var name = strings.TrimPrefix(filepath.Clean("/"+tt.path), "/")
+		buf, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if got := string(buf); (tt.file == "-") != os.IsNotExist(err) || (err == nil && got != tt.file) {
+			t.Errorf("%s: file %q (error %v), want %q", tt.name, got, err, tt.file)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "outside.gmi")); err == nil {
+		t.Errorf("upload escaped the directory")
+	}
+	// the temporary files are gone
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".upload-*")); len(leftovers) > 0 {
+		t.Errorf("temporary files %v", leftovers)
+	}
+}
+
+func TestUploadFilesEmptyToken(t *testing.T) {
+	var dir = t.TempDir()
+	var rec recorder
+	UploadFiles(dir, 100, "").ServeGemini(&rec, &Request{
+		URL:    mustURL(t, "titan://capsule.example/page.gmi"),
+		Upload: &Upload{Mime: "text/gemini", Size: 1, Body: strings.NewReader("x")},
+	})
+	if rec.status != StatusPermanentFailure {
+		t.Errorf("empty token status %d, want %d", rec.status, StatusPermanentFailure)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("files written without a token")
+	}
+}
+
+// Titan requests over the connection, refused unless enabled
+func TestServeTitan(t *testing.T) {
+	var echo = Titan(8, "", func(w ResponseWriter, r *Request, up *Upload) {
+		body, _ := io.ReadAll(up.Body)
+		w.WriteHeader(StatusSuccess, "text/plain")
+		io.WriteString(w, r.URL.Path+" "+up.Mime+" "+string(body))
+	})
+	var tests = []struct {
+		name string
+		max  int64
+		line string
+		want string
+	}{
+		{"upload", 8, "titan://localhost:%s/page.gmi;mime=text/plain;size=5\r\nhello", "20 text/plain\r\n/page.gmi text/plain hello"},
+		{"body is not read past the size", 8, "titan://localhost:%s/a;size=2\r\nhello", "20 text/plain\r\n/a text/gemini he"},
+		{"over the server limit", 8, "titan://localhost:%s/a;size=9\r\n123456789", "59 Upload exceeds 8 bytes\r\n"},
+		{"no size", 8, "titan://localhost:%s/a\r\n", "59 Titan size is required\r\n"},
+		{"disabled", 0, "titan://localhost:%s/a;size=1\r\nx", "53 Proxy requests are refused\r\n"},
+	}
+	for _, tt := range tests {
+		var addr = startServer(t, &Server{Handler: echo, MaxUploadSize: tt.max})
+		_, port, _ := net.SplitHostPort(addr)
+		var got = exchange(t, addr, "localhost", strings.Replace(tt.line, "%s", port, 1))
+		if got != tt.want {
+			t.Errorf("%s: response %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
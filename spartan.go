@@ -0,0 +1,82 @@
+package gmi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Spartan is the plain TCP sibling of Gemini, the request line is
+// `host path content-length` followed by the data block
+const spartanPort = "300"
+
+// InputURL is the address with the text of the prompt as its query
+// (Spartan input lines send the query as the data block)
+func InputURL(u *url.URL, text string) *url.URL {
+	var cp = *u
+	cp.RawQuery = strings.ReplaceAll(url.QueryEscape(text), "+", "%20")
+	cp.Fragment = ""
+	return &cp
+}
+
+// send the Spartan request, the query of the URL (percent-decoded)
+// becomes the data block
+func (c *control) spartan(u *url.URL, cfg Params) (*bufio.Reader, error) {
+	data, err := url.PathUnescape(u.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("Spartan data malformed, %w", err)
+	}
+	if err = c.dialPlain(u, spartanPort); err != nil {
+		return nil, err
+	}
+	var path = u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	var req = fmt.Sprintf("%s %s %d\r\n%s", u.Hostname(), path, len(data), data)
+	if _, err = io.WriteString(c.conn, req); err != nil {
+		return c.dialError("Spartan request failed, %w", err)
+	}
+	return c.spartanResponse(u, cfg)
+}
+
+// read the response header, <STATUS><SPACE><META><CR><LF> with the
+// single digit status (2 success, 3 redirect, 4 and 5 errors)
+func (c *control) spartanResponse(u *url.URL, cfg Params) (*bufio.Reader, error) {
+	reader := bufio.NewReader(c.conn)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return c.dialError("Failed to read response %w", err)
+	}
+	status, meta, _ := strings.Cut(strings.TrimRight(header, "\r\n"), " ")
+	meta = strings.TrimSpace(meta)
+	switch status {
+	case "2":
+		if meta == "" {
+			meta = "text/gemini"
+		}
+		if !c.accepts(meta) {
+			return c.dialError("Not-implemented MIME support, " + meta)
+		}
+		c.base, c.meta = u, meta
+		return reader, nil
+
+	case "3":
+		// the redirect is a path on the same host
+		if meta == "" {
+			return c.dialError("REDIR meta header field error")
+		}
+		lu, err := u.Parse(meta)
+		if err != nil || lu.Host != u.Host {
+			return c.dialError("REDIR " + meta)
+		}
+		return c.redirect(30, lu, cfg)
+	case "4":
+		return c.dialError("ERROR: spartan client error, " + meta)
+	case "5":
+		return c.dialError("ERROR: spartan server error, " + meta)
+	}
+	return c.dialError("Exceptional status code did not match known values.")
+}
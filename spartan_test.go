@@ -0,0 +1,182 @@
+package gmi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// plain TCP server on a local port, respond reads the request of
+// each connection and returns the response, the requests are kept
+type plainServer struct {
+	addr string
+	mu   sync.Mutex
+	reqs []string
+}
+
+func servePlain(t *testing.T, respond func(r *bufio.Reader) (req, resp string)) *plainServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var ps = &plainServer{addr: ln.Addr().String()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				req, resp := respond(bufio.NewReader(conn))
+				ps.mu.Lock()
+				ps.reqs = append(ps.reqs, req)
+				ps.mu.Unlock()
+				io.WriteString(conn, resp)
+			}(conn)
+		}
+	}()
+	return ps
+}
+
+func (ps *plainServer) requests() []string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return append([]string(nil), ps.reqs...)
+}
+
+// the request line and the data block, the response is picked by the path
+func spartanServer(t *testing.T, pages map[string]string) *plainServer {
+	return servePlain(t, func(r *bufio.Reader) (string, string) {
+		line, _ := r.ReadString('\n')
+		var fields = strings.Fields(line)
+		if len(fields) != 3 {
+			return line, "4 malformed request\r\n"
+		}
+		size, _ := strconv.Atoi(fields[2])
+		var data = make([]byte, size)
+		io.ReadFull(r, data)
+		return line + string(data), pages[fields[1]]
+	})
+}
+
+func TestSpartan(t *testing.T) {
+	var tests = []struct {
+		name string
+		path string
+		meta string
+		body string
+		reqs []string // %s is the host
+		err  string
+	}{
+		{"page", "/", "text/gemini", "# Home\n", []string{"127.0.0.1 / 0\r\n"}, ""},
+		{"no path", "", "text/gemini", "# Home\n", []string{"127.0.0.1 / 0\r\n"}, ""},
+		{"default mime", "/bare", "text/gemini", "bare", []string{"127.0.0.1 /bare 0\r\n"}, ""},
+		{"data block", "/form?hello%20world", "text/plain", "posted", []string{"127.0.0.1 /form 11\r\nhello world"}, ""},
+		{"redirect", "/old", "text/gemini", "# Home\n", []string{"127.0.0.1 /old 0\r\n", "127.0.0.1 / 0\r\n"}, ""},
+		{"other host", "/away", "", "", []string{"127.0.0.1 /away 0\r\n"}, "REDIR //other.example/"},
+		{"empty redirect", "/nowhere", "", "", []string{"127.0.0.1 /nowhere 0\r\n"}, "REDIR meta header field error"},
+		{"redirect loop", "/loop", "", "", nil, "REDIR limit of 5 redirects exceeded"},
+		{"client error", "/missing", "", "", []string{"127.0.0.1 /missing 0\r\n"}, "spartan client error, not found"},
+		{"server error", "/broken", "", "", []string{"127.0.0.1 /broken 0\r\n"}, "spartan server error, oops"},
+		{"binary", "/logo.png", "", "", []string{"127.0.0.1 /logo.png 0\r\n"}, "Not-implemented MIME support, image/png"},
+		{"unknown status", "/odd", "", "", []string{"127.0.0.1 /odd 0\r\n"}, "Exceptional status code"},
+		{"bad data", "/form?%zz", "", "", []string{}, "Spartan data malformed"},
+	}
+	for _, tt := range tests {
+		var ps = spartanServer(t, map[string]string{
+			"/":         "2 text/gemini\r\n# Home\n",
+			"/bare":     "2\r\nbare",
+			"/form":     "2 text/plain\r\nposted",
+			"/old":      "3 /\r\n",
+			"/away":     "3 //other.example/\r\n",
+			"/nowhere":  "3\r\n",
+			"/loop":     "3 /loop\r\n",
+			"/missing":  "4 not found\r\n",
+			"/broken":   "5 oops\r\n",
+			"/logo.png": "2 image/png\r\n\x89PNG",
+			"/odd":      "9 what\r\n",
+		})
+		u, _ := url.Parse("spartan://" + ps.addr + tt.path)
+		var ctrl = NewControl(context.Background())
+		rdr, err := ctrl.Dial(u, nil)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: Dial error %v, want %s", tt.name, err, tt.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: Dial, %v", tt.name, err)
+		} else {
+			body, _ := io.ReadAll(rdr)
+			if ctrl.Meta() != tt.meta || string(body) != tt.body {
+				t.Errorf("%s: response %q %q, want %q %q", tt.name, ctrl.Meta(), body, tt.meta, tt.body)
+			}
+		}
+		ctrl.Close()
+		if tt.reqs == nil {
+			continue
+		}
+		if got := ps.requests(); strings.Join(got, "|") != strings.Join(tt.reqs, "|") {
+			t.Errorf("%s: requests %q, want %q", tt.name, got, tt.reqs)
+		}
+	}
+}
+
+// the redirect is returned to the caller, the filter passes binary bodies
+func TestSpartanControl(t *testing.T) {
+	var ps = spartanServer(t, map[string]string{
+		"/old":      "3 /new\r\n",
+		"/logo.png": "2 image/png\r\n\x89PNG",
+	})
+	u, _ := url.Parse("spartan://" + ps.addr + "/old")
+	var ctrl = NewControl(context.Background())
+	ctrl.StopRedirect()
+	var re *RedirectError
+	if _, err := ctrl.Dial(u, nil); !errors.As(err, &re) || re.Status != 30 || re.URL.Path != "/new" {
+		t.Errorf("stopped redirect error %v", err)
+	}
+	ctrl.Close()
+
+	u, _ = url.Parse("spartan://" + ps.addr + "/logo.png")
+	ctrl = NewControl(context.Background())
+	ctrl.Accept(func(string) bool { return true })
+	defer ctrl.Close()
+	rdr, err := ctrl.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("Dial with the filter, %v", err)
+	}
+	if body, _ := io.ReadAll(rdr); ctrl.Meta() != "image/png" || string(body) != "\x89PNG" {
+		t.Errorf("binary response %q %q", ctrl.Meta(), body)
+	}
+}
+
+func TestInputURL(t *testing.T) {
+	var tests = []struct {
+		addr string
+		text string
+		want string
+	}{
+		{"spartan://capsule.example/form", "hello world", "spartan://capsule.example/form?hello%20world"},
+		{"spartan://capsule.example/form?old#frag", "a+b&c=d", "spartan://capsule.example/form?a%2Bb%26c%3Dd"},
+		{"gemini://capsule.example/search", "", "gemini://capsule.example/search"},
+		{"spartan://capsule.example/", "ünï", "spartan://capsule.example/?%C3%BCn%C3%AF"},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.addr)
+		if got := InputURL(u, tt.text).String(); got != tt.want {
+			t.Errorf("%s %q: URL %s, want %s", tt.addr, tt.text, got, tt.want)
+		}
+		if u.String() != tt.addr {
+			t.Errorf("%s: the address was changed to %s", tt.addr, u)
+		}
+	}
+}
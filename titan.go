@@ -0,0 +1,113 @@
+package gmi
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Upload is the body of a Titan request (the companion protocol
+// which writes to a capsule)
+type Upload struct {
+	Body  io.Reader
+	Size  int64
+	Mime  string // defaults to text/gemini
+	Token string // optional, the capsule decides what it means
+}
+
+// TitanURL is the Titan address of the page with the upload parameters
+// (titan://host/path;mime=text/gemini;size=12;token=secret)
+func TitanURL(u *url.URL, up Upload) *url.URL {
+	var cp = *u
+	cp.Scheme = "titan"
+	cp.RawQuery, cp.Fragment = "", ""
+	if cp.Port() == "" {
+		cp.Host += ":1965"
+	}
+	if cp.Path == "" {
+		cp.Path = "/"
+	}
+	// parameters of the MIME type cannot be expressed (;charset)
+	var mt = strings.TrimSpace(strings.SplitN(up.Mime, ";", 2)[0])
+	if mt == "" {
+		mt = "text/gemini"
+	}
+	var params = ";mime=" + mt + ";size=" + strconv.FormatInt(up.Size, 10)
+	if up.Token != "" {
+		params += ";token=" + url.PathEscape(up.Token)
+	}
+	cp.RawPath = cp.EscapedPath() + params
+	cp.Path += ";mime=" + mt + ";size=" + strconv.FormatInt(up.Size, 10)
+	if up.Token != "" {
+		cp.Path += ";token=" + up.Token
+	}
+	return &cp
+}
+
+// Upload sends the body to the page address (gemini or titan URL), the
+// response is read like Dial (capsules usually redirect to the page)
+func (c *control) Upload(u *url.URL, up Upload, cfg Params) (*bufio.Reader, error) {
+	if up.Size < 0 {
+		return nil, fmt.Errorf("Titan upload size is unknown")
+	}
+	var tu = TitanURL(u, up)
+	if err := c.connect(tu, cfg); err != nil {
+		return nil, err
+	}
+	if _, err := c.conn.Write([]byte(tu.String() + "\r\n")); err != nil {
+		return c.dialError("Titan request failed, %w", err)
+	}
+	if up.Size > 0 {
+		n, err := io.Copy(c.conn, io.LimitReader(up.Body, up.Size))
+		if err != nil {
+			return c.dialError("Titan upload failed, %w", err)
+		}
+		if n != up.Size {
+			return c.dialError(fmt.Sprintf("Titan upload short, %d of %d bytes", n, up.Size))
+		}
+	}
+	// the redirect after the upload is a gemini request
+	var page = *u
+	if page.Scheme == "titan" {
+		page.Scheme = "gemini"
+	}
+	return c.response(&page, cfg)
+}
+
+// Upload is the convenience to make a control and send the upload,
+// the caller is responsible to Close the control when done reading.
+func (c *Client) Upload(ctx context.Context, u *url.URL, up Upload) (*control, *bufio.Reader, error) {
+	ctrl := c.Control(ctx)
+	rdr, err := ctrl.Upload(u, up, c.cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ctrl, rdr, nil
+}
+
+// UploadFile sends the file, the MIME type is derived from the extension
+func (c *Client) UploadFile(ctx context.Context, u *url.URL, path string, token string) (*control, *bufio.Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	var mt = "text/gemini"
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".gmi" && ext != ".gemini" {
+		if mt = mime.TypeByExtension(ext); mt == "" {
+			mt = "application/octet-stream"
+		}
+	}
+	return c.Upload(ctx, u, Upload{Body: file, Size: fi.Size(), Mime: mt, Token: token})
+}
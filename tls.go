@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -14,12 +15,16 @@ import "golang.org/x/crypto/ssh"
 import kh "golang.org/x/crypto/ssh/knownhosts"
 
 func dialTLS(ctx context.Context, u *url.URL) (*tls.Conn, error) {
-	conn, err := tls.Dial("tcp", u.Host, nil)
+	var dialer = &tls.Dialer{NetDialer: &net.Dialer{}}
+	conn, err := dialer.DialContext(ctx, "tcp", u.Host)
 	if err == nil {
 		// standard verify success!
-		return conn, nil
+		return conn.(*tls.Conn), nil
 	}
-	if u.Scheme != "gemini" {
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	if u.Scheme != "gemini" && u.Scheme != "titan" {
 		return nil, err
 	}
 	return dialGemini(ctx, u.Host, certFrom(err))
@@ -37,7 +42,12 @@ func dialGemini(ctx context.Context, capsule string, cert *x509.Certificate) (*t
 			return recoveryVerify(cs, cert, isv, knownCap)
 		},
 	}
-	return tls.Dial("tcp", capsule, cfg)
+	var dialer = &tls.Dialer{NetDialer: &net.Dialer{}, Config: cfg}
+	conn, err := dialer.DialContext(ctx, "tcp", capsule)
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*tls.Conn), nil
 }
 
 // verify which can toggle fallbacks
@@ -69,6 +79,11 @@ func knownCapsules(ctx context.Context, capsule string, cert *x509.Certificate,
 	if isv.Not(PromptUAE) {
 		return false
 	}
+	if ts := paramTrust(ctx); ts != nil {
+		// concurrent requests share the known capsules file
+		ts.Lock()
+		defer ts.Unlock()
+	}
 	var err error
 	if err = searchKnown(ctx, capsule, cert); err == nil {
 		return true
@@ -139,13 +154,17 @@ func searchKnown(ctx context.Context, capsule string, cert *x509.Certificate) er
 func certFrom(err error) *x509.Certificate {
 	//TODO graceful when error is unsupported
 	// supported errors are unknown-auth, commonname, expired
-	switch et := err.(type) {
-	case x509.UnknownAuthorityError:
-		uae, _ := err.(x509.UnknownAuthorityError)
+	// (newer Go wraps them in tls.CertificateVerificationError)
+	var (
+		uae x509.UnknownAuthorityError
+		hne x509.HostnameError
+		cie x509.CertificateInvalidError
+	)
+	switch {
+	case errors.As(err, &uae):
 		return uae.Cert
 
-	case x509.HostnameError:
-		hne, _ := err.(x509.HostnameError)
+	case errors.As(err, &hne):
 		log.Printf("DEBUG Name err cn: %v, h:%s, sz: %d",
 			hne.Certificate.Subject.CommonName, hne.Host,
 			len(hne.Certificate.DNSNames))
@@ -153,15 +172,14 @@ func certFrom(err error) *x509.Certificate {
 			return hne.Certificate
 		}
 
-	case x509.CertificateInvalidError:
-		cie, _ := err.(x509.CertificateInvalidError)
+	case errors.As(err, &cie):
 		if cie.Reason == x509.Expired {
 			log.Printf("DEBUG Expired cert, %s", cie.Detail)
 			return cie.Cert
 		}
 
 	default:
-		log.Printf("DEBUG Cert error type, %T", et)
+		log.Printf("DEBUG Cert error type, %T", err)
 		return nil
 	}
 	return nil
@@ -199,3 +217,24 @@ func paramKnowns(ctx context.Context) string {
 	log.Printf("INFO config kh path, %v", cfg.KnownHosts())
 	return cfg.KnownHosts()
 }
+
+// TrustOnFirstUse is the Params which pins the capsule key in the
+// known capsules file (created when missing) the first time the
+// capsule is seen, a capsule which changes its key later is refused
+// until its line is removed from the file
+func TrustOnFirstUse(known string) (Params, error) {
+	// the file has to exist before the first lookup
+	file, err := os.OpenFile(known, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Known capsules file, %w", err)
+	}
+	if err = file.Close(); err != nil {
+		return nil, fmt.Errorf("Known capsules file, %w", err)
+	}
+	return tofu(known), nil
+}
+
+type tofu string
+
+func (t tofu) ISV() Mask          { return PromptUAE | AcceptLCN }
+func (t tofu) KnownHosts() string { return string(t) }
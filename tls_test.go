@@ -0,0 +1,189 @@
+package gmi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// self-signed capsule certificate with a fresh key
+func capsuleCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tmpl = &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// capsule which answers every request with the page, the
+// certificate is read from current on each handshake
+func serveCapsule(t *testing.T, current *atomic.Value, page string) *url.URL {
+	t.Helper()
+	return serveGemini(t, current, func(*url.URL) string { return "20 text/gemini\r\n" + page })
+}
+
+// capsule which answers with the response (header and body) for
+// the requested URL
+func serveGemini(t *testing.T, current *atomic.Value, respond func(req *url.URL) string) *url.URL {
+	t.Helper()
+	var cfg = &tls.Config{GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		var cert = current.Load().(tls.Certificate)
+		return &cert, nil
+	}}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				// the client hangs up on the handshake of the
+				// self-signed certificate before it redials
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil {
+					return
+				}
+				req, err := url.Parse(strings.TrimRight(line, "\r\n"))
+				if err != nil {
+					return
+				}
+				conn.Write([]byte(respond(req)))
+			}(conn)
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	u, _ := url.Parse("gemini://localhost:" + port + "/")
+	return u
+}
+
+func TestTrustOnFirstUse(t *testing.T) {
+	var known = filepath.Join(t.TempDir(), "known_capsules")
+	cfg, err := TrustOnFirstUse(known)
+	if err != nil {
+		t.Fatalf("TrustOnFirstUse, %v", err)
+	}
+	if _, err = os.Stat(known); err != nil {
+		t.Fatalf("known capsules file is missing, %v", err)
+	}
+	var (
+		cert, other = capsuleCert(t), capsuleCert(t)
+		current     atomic.Value
+	)
+	current.Store(cert)
+	var u = serveCapsule(t, &current, "# page\n")
+	var tests = []struct {
+		name string
+		cert tls.Certificate
+		ok   bool
+	}{
+		{"first use pins", cert, true},
+		{"same key", cert, true},
+		{"changed key", other, false},
+	}
+	for _, tt := range tests {
+		current.Store(tt.cert)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctrl, _, err := NewClient(cfg).Dial(ctx, u)
+		cancel()
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("%s: Dial error %v, want ok %v", tt.name, err, tt.ok)
+		}
+		if err == nil {
+			ctrl.Close()
+		}
+	}
+	if buf, _ := os.ReadFile(known); len(bytes.Split(bytes.TrimSpace(buf), []byte("\n"))) != 1 {
+		t.Errorf("known capsules %q, want the one pin", buf)
+	}
+}
+
+// redirects are followed up to the limit, each Dial starts over
+func TestRedirectLimit(t *testing.T) {
+	cfg, err := TrustOnFirstUse(filepath.Join(t.TempDir(), "known_capsules"))
+	if err != nil {
+		t.Fatalf("TrustOnFirstUse, %v", err)
+	}
+	var current atomic.Value
+	current.Store(capsuleCert(t))
+	var hops atomic.Int32
+	var u = serveGemini(t, &current, func(req *url.URL) string {
+		hops.Add(1)
+		// /r3 redirects to /r2 and so on, /r0 is the page
+		n, err := strconv.Atoi(strings.TrimPrefix(req.Path, "/r"))
+		if err != nil {
+			return "51 Not found\r\n"
+		}
+		if n == 0 {
+			return "20 text/gemini\r\n# arrived\n"
+		}
+		return fmt.Sprintf("31 /r%d\r\n", n-1)
+	})
+	var tests = []struct {
+		path string
+		hops int32
+		err  string
+	}{
+		{"/r0", 1, ""},
+		{"/r5", 6, ""},
+		{"/r5", 6, ""},
+		{"/r6", 6, "REDIR limit of 5 redirects exceeded"},
+		{"/r9", 6, "REDIR limit of 5 redirects exceeded"},
+	}
+	for _, tt := range tests {
+		hops.Store(0)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctrl, rdr, err := NewClient(cfg).Dial(ctx, u.ResolveReference(&url.URL{Path: tt.path}))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: Dial error %v, want %s", tt.path, err, tt.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: Dial, %v", tt.path, err)
+		} else {
+			if body, _ := io.ReadAll(rdr); string(body) != "# arrived\n" || ctrl.URL().Path != "/r0" {
+				t.Errorf("%s: page %s %q", tt.path, ctrl.URL(), body)
+			}
+			ctrl.Close()
+		}
+		cancel()
+		if got := hops.Load(); got != tt.hops {
+			t.Errorf("%s: %d requests, want %d", tt.path, got, tt.hops)
+		}
+	}
+}
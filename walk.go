@@ -0,0 +1,120 @@
+package gmi
+
+import "strings"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(n Node) (w Visitor)
+}
+
+// Walk traverses the node tree in depth-first order (the same
+// order as the lines of the page).
+func Walk(v Visitor, n Node) {
+	if v = v.Visit(n); v == nil {
+		return
+	}
+	if l, ok := n.(*ListNode); ok {
+		for _, child := range l.Nodes {
+			Walk(v, child)
+		}
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(n Node) Visitor {
+	if f(n) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the node tree in depth-first order: it starts by
+// calling f(n); if f returns true, Inspect invokes f recursively for
+// each of the children of n, followed by a call of f(nil).
+func Inspect(n Node, f func(Node) bool) {
+	Walk(inspector(f), n)
+}
+
+// Links are the link lines of the page in order
+func (t *Tree) Links() []*LinkNode {
+	var links []*LinkNode
+	t.inspect(func(n Node) {
+		if lnk, ok := n.(*LinkNode); ok {
+			links = append(links, lnk)
+		}
+	})
+	return links
+}
+
+// Headings are the heading lines of the page in order
+func (t *Tree) Headings() []*HeadingNode {
+	var headings []*HeadingNode
+	t.inspect(func(n Node) {
+		if hd, ok := n.(*HeadingNode); ok {
+			headings = append(headings, hd)
+		}
+	})
+	return headings
+}
+
+// Title is the text of the first heading (empty when none)
+func (t *Tree) Title() string {
+	var title string
+	if t == nil || t.Root == nil {
+		return title
+	}
+	Inspect(t.Root, func(n Node) bool {
+		if hd, ok := n.(*HeadingNode); ok && title == "" {
+			title = strings.TrimSpace(hd.Heading)
+		}
+		return title == ""
+	})
+	return title
+}
+
+// Section is one entry of the outline (table of contents)
+type Section struct {
+	Heading  *HeadingNode
+	Sections []*Section // Sub-headings of a lower level.
+}
+
+// Outline nests the headings by level, a skipped level (# then ###)
+// becomes the child of the nearest higher heading.
+func (t *Tree) Outline() []*Section {
+	var (
+		top   []*Section
+		stack []*Section
+	)
+	for _, hd := range t.Headings() {
+		sec := &Section{Heading: hd}
+		// close the sections at the same or lower level
+		for len(stack) > 0 && stack[len(stack)-1].Heading.Level >= hd.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			top = append(top, sec)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Sections = append(parent.Sections, sec)
+		}
+		stack = append(stack, sec)
+	}
+	return top
+}
+
+// visit every node of the tree (nil safe)
+func (t *Tree) inspect(f func(Node)) {
+	if t == nil || t.Root == nil {
+		return
+	}
+	Inspect(t.Root, func(n Node) bool {
+		if n != nil {
+			f(n)
+		}
+		return true
+	})
+}
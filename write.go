@@ -0,0 +1,47 @@
+package gmi
+
+import (
+	"io"
+	"strings"
+)
+
+// WriteTo serializes the tree as canonical gemtext (one line per
+// node in order, single space after the line prefix); with Verbatim
+// the lines keep the whitespace of the original input instead.
+func (t *Tree) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	if t.Root != nil {
+		for _, n := range t.Root.Nodes {
+			if raw := original(n); t.Verbatim && raw != nil {
+				sb.Write(raw)
+			} else {
+				n.writeTo(&sb)
+			}
+			sb.WriteString("\n")
+		}
+	}
+	wr, err := io.WriteString(w, sb.String())
+	return int64(wr), err
+}
+
+// the input text of the node (nil when constructed by code)
+func original(n Node) []byte {
+	switch no := n.(type) {
+	case *TextNode:
+		// plain text has no prefix whitespace to keep
+		return nil
+	case *LinkNode:
+		return no.Text
+	case *PromptNode:
+		return no.Text
+	case *HeadingNode:
+		return no.Text
+	case *ItemNode:
+		return no.Text
+	case *QuoteNode:
+		return no.Text
+	case *PreformatNode:
+		return no.Text
+	}
+	return nil
+}
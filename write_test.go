@@ -0,0 +1,141 @@
+package gmi
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// lines of every type, with the odd whitespace and prefixes
+var corpus = []string{
+	"# Heading",
+	"##Heading without space",
+	"###   Spaced heading",
+	"#### four marks",
+	"#",
+	"=> gemini://example.org/ Example",
+	"=>/relative.gmi",
+	"=>\t/tab.gmi \t Tab name",
+	"=>",
+	"=> ",
+	"=: /search Search",
+	"* item",
+	"*",
+	"*not an item",
+	"> quote",
+	">",
+	">>nested",
+	"```alt text",
+	"```",
+	"plain text",
+	"",
+	"   leading spaces",
+	" => escaped link",
+	"trailing spaces   ",
+	"crlf text\r",
+	"* crlf item\r",
+	"=> /crlf.gmi CRLF link\r",
+	"lone\rcarriage return",
+	"\r",
+	"*\r",
+}
+
+// parse, serialize, parse again, the second text is the same
+func roundTrip(t *testing.T, input string, verbatim bool) {
+	t.Helper()
+	t1, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse %q, %v", input, err)
+	}
+	t1.Verbatim = verbatim
+	var s1 strings.Builder
+	t1.WriteTo(&s1)
+	t2, err := Parse(s1.String())
+	if err != nil {
+		t.Fatalf("Parse serialized %q, %v", s1.String(), err)
+	}
+	t2.Verbatim = verbatim
+	var s2 strings.Builder
+	t2.WriteTo(&s2)
+	if s1.String() != s2.String() {
+		t.Fatalf("round trip of %q is not stable\nfirst  %q\nsecond %q", input, s1.String(), s2.String())
+	}
+	if got, want := nodeTypes(t2), nodeTypes(t1); got != want {
+		t.Fatalf("round trip of %q changed the node types\nfirst  %s\nsecond %s", input, want, got)
+	}
+}
+
+func nodeTypes(t *Tree) string {
+	var sb strings.Builder
+	for _, n := range t.Root.Nodes {
+		sb.WriteByte(byte('a' + n.Type()))
+	}
+	return sb.String()
+}
+
+func TestWriteToCorpus(t *testing.T) {
+	var page = strings.Join(corpus, "\n") + "\n```\nunterminated preformat\n=> inside pre"
+	roundTrip(t, page, false)
+	roundTrip(t, page, true)
+}
+
+func TestWriteToRandom(t *testing.T) {
+	var rnd = rand.New(rand.NewSource(1965))
+	for i := 0; i < 500; i++ {
+		var rows = make([]string, rnd.Intn(12)+1)
+		for j := range rows {
+			rows[j] = corpus[rnd.Intn(len(corpus))]
+		}
+		var page = strings.Join(rows, "\n")
+		if rnd.Intn(2) == 0 {
+			page += "\n"
+		}
+		roundTrip(t, page, rnd.Intn(2) == 0)
+	}
+}
+
+// the corpus is joined by LF, these end the input with the CR
+func TestWriteToCarriageReturn(t *testing.T) {
+	for _, page := range []string{"\r", "*\r", "# Title\r", "=> /a Name\r", "text\r\n", "one\r\ntwo\r", "```\r\npre\r"} {
+		for _, verbatim := range []bool{false, true} {
+			roundTrip(t, page, verbatim)
+		}
+	}
+}
+
+func TestWriteToVerbatim(t *testing.T) {
+	var page = "##  Spaced\n=>  /a   Name\n*  item\n"
+	tree, err := Parse(page)
+	if err != nil {
+		t.Fatalf("Parse, %v", err)
+	}
+	tree.Verbatim = true
+	var sb strings.Builder
+	tree.WriteTo(&sb)
+	if sb.String() != page {
+		t.Errorf("Verbatim %q, want %q", sb.String(), page)
+	}
+	tree.Verbatim = false
+	sb.Reset()
+	tree.WriteTo(&sb)
+	if want := "## Spaced\n=> /a Name\n* item\n"; sb.String() != want {
+		t.Errorf("canonical %q, want %q", sb.String(), want)
+	}
+}
+
+// text made by code which looks like a line prefix stays text
+func TestWriteToEscape(t *testing.T) {
+	var doc = NewDocument().Text("=> not a link\n# not a heading\n* not an item\n> not a quote\n```not a toggle\n=: not a prompt")
+	var sb strings.Builder
+	doc.WriteTo(&sb)
+	tree, err := Parse(sb.String())
+	if err != nil {
+		t.Fatalf("Parse, %v", err)
+	}
+	for _, n := range tree.Root.Nodes {
+		if n.Type() != NodeText {
+			t.Errorf("escaped line %q parsed as node type %d", n.String(), n.Type())
+		}
+	}
+	roundTrip(t, sb.String(), false)
+}